@@ -0,0 +1,155 @@
+package batch
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/model"
+	"github.com/vrld/ansicht/internal/runtime"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// Controller for scripts that run without the TUI. Queries are searched
+// synchronously, status and notifications are written to Output and
+// spawn results are queued until Run handles them.
+type Adapter struct {
+	Output      io.Writer
+	quit        bool
+	errorCount  int
+	searched    model.SearchQuery
+	spawnResult chan runtime.SpawnResult
+}
+
+func NewAdapter(output io.Writer) *Adapter {
+	return &Adapter{
+		Output:      output,
+		spawnResult: make(chan runtime.SpawnResult),
+	}
+}
+
+func (a *Adapter) Quit() {
+	a.quit = true
+}
+
+func (a *Adapter) Refresh(messages []model.MessageID) {
+	query, ok := service.Queries().Current()
+	if !ok {
+		return
+	}
+
+	if len(messages) == 0 {
+		a.search(true)
+		return
+	}
+
+	updated, removed, err := db.RefreshMessages(&query, messages)
+	if err != nil {
+		a.Notify(err.Error(), "error", 0)
+		return
+	}
+	service.Messages().UpdateMessages(updated)
+	service.Messages().RemoveMessages(removed)
+}
+
+func (a *Adapter) Status(message string) {
+	service.Status().Set(message)
+	if message != "" {
+		fmt.Fprintln(a.Output, message)
+	}
+}
+
+func (a *Adapter) Notify(message string, level string, timeout float64) {
+	if level == "error" {
+		a.errorCount++
+	}
+	fmt.Fprintf(a.Output, "%s: %s\n", level, message)
+}
+
+func (a *Adapter) Input(prompt, placeholder string) {
+	a.Notify(fmt.Sprintf("no input in batch mode: %s", prompt), "warning", 0)
+}
+
+// called from the goroutine of the spawned command
+func (a *Adapter) SpawnResult(result runtime.SpawnResult) {
+	a.spawnResult <- result
+}
+
+func (a *Adapter) SetTheme(theme any) {}
+
+func (a *Adapter) QueryNew(query model.SearchQuery) {
+	if query.Name == "" {
+		query.Name = query.Query
+	}
+	service.Queries().Add(query)
+	service.Queries().SelectLast()
+	a.search(false)
+}
+
+func (a *Adapter) QuerySelectNext() {
+	service.Queries().SelectNext()
+	a.search(false)
+}
+
+func (a *Adapter) QuerySelectPrev() {
+	service.Queries().SelectPrevious()
+	a.search(false)
+}
+
+func (a *Adapter) QueryChanged() {
+	if query, ok := service.Queries().Current(); ok && !query.SameSearch(a.searched) {
+		a.search(false)
+	}
+}
+
+func (a *Adapter) MarksToggle() {
+	messages := service.ActiveMessages()
+	messages.ToggleMark(messages.Selected())
+}
+
+func (a *Adapter) MarksInvert() {
+	service.ActiveMessages().InvertMarks()
+}
+
+func (a *Adapter) MarksClear() {
+	service.ActiveMessages().ClearMarks()
+}
+
+func (a *Adapter) ThreadOpen(threadID string) {
+	thread, nodes, err := db.FindThreadTree(threadID)
+	if err != nil {
+		a.Notify(err.Error(), "error", 0)
+		return
+	}
+	service.ThreadMessages().SetThreadTree(thread, nodes)
+	service.View().Set(service.ViewThread)
+}
+
+func (a *Adapter) ThreadClose() {
+	service.View().Set(service.ViewList)
+}
+
+func (a *Adapter) PreviewToggle()          {}
+func (a *Adapter) PreviewResize(int, bool) {}
+func (a *Adapter) PreviewScroll(int)       {}
+
+// loads the messages of the current query, reload keeps marks and selection
+func (a *Adapter) search(reload bool) {
+	query, ok := service.Queries().Current()
+	if !ok {
+		return
+	}
+
+	a.searched = query
+	result, err := db.FindThreads(&query)
+	if err != nil {
+		a.Notify(err.Error(), "error", 0)
+		return
+	}
+	if reload {
+		service.Messages().ReloadThreads(result.Threads)
+	} else {
+		service.Messages().SetThreads(result.Threads)
+	}
+	service.View().Set(service.ViewList)
+}
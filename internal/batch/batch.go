@@ -0,0 +1,64 @@
+package batch
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vrld/ansicht/internal/model"
+	"github.com/vrld/ansicht/internal/runtime"
+)
+
+// Runs a Lua script without the TUI and returns the exit code: the code
+// passed to ansicht.quit(), or 1 if an error occurred.
+// If query is not empty, its messages are loaded before the script runs.
+// Otherwise the first saved query is used.
+func Run(r *runtime.Runtime, luaCode, chunkName, query string) int {
+	adapter := NewAdapter(os.Stderr)
+	r.Controller = adapter
+
+	// rules in the user config must not silently be replaced by the defaults
+	if errs := r.StartupErrors(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+
+	if query != "" {
+		adapter.QueryNew(model.SearchQuery{Query: query})
+	} else {
+		adapter.search(false)
+	}
+
+	if err := r.RunScript(luaCode, chunkName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// spawn callbacks may spawn more commands
+	for !adapter.quit && r.PendingSpawns() > 0 {
+		result := <-adapter.spawnResult
+		r.HandleSpawnResult(result)
+		r.Emit(runtime.EventSpawnFinished, result.EventData())
+	}
+
+	r.Emit(runtime.EventQuit, nil)
+
+	if adapter.errorCount > 0 && r.ExitCode() == 0 {
+		return 1
+	}
+	return r.ExitCode()
+}
+
+// the script given with -script or -e
+func ReadScript(path, code string) (luaCode string, chunkName string, err error) {
+	if code != "" {
+		return code, "command line", nil
+	}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot read script: %w", err)
+	}
+	return string(bytes), path, nil
+}
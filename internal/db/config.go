@@ -0,0 +1,172 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Saved queries are edited in place, line by line, so that comments, blank
+// lines and the order of the other entries in the notmuch config survive.
+
+// Adds or replaces the named query in the [query] section of the notmuch
+// config, making it available as `query:NAME`.
+func SaveQuery(name, query string) error {
+	if err := validateQueryName(name); err != nil {
+		return err
+	}
+	if strings.ContainsAny(query, "\r\n") {
+		return fmt.Errorf("query must not span multiple lines")
+	}
+
+	return editNotmuchConfig(func(lines []string) ([]string, bool) {
+		entry := name + "=" + query
+		start, end, found := querySection(lines)
+		if !found {
+			if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+				lines = append(lines, "")
+			}
+			return append(lines, "[query]", entry), true
+		}
+
+		if i := findQueryKey(lines[start:end], name); i >= 0 {
+			lines[start+i] = entry
+			return lines, true
+		}
+
+		// insert after the last entry, before blank lines and comments that
+		// belong to the next section
+		insert := start
+		for i := start; i < end; i++ {
+			if !isBlankOrComment(lines[i]) {
+				insert = i + 1
+			}
+		}
+		return append(lines[:insert], append([]string{entry}, lines[insert:]...)...), true
+	})
+}
+
+// Removes the named query from the notmuch config.
+// Returns false if there was no such query.
+func DeleteQuery(name string) (deleted bool, err error) {
+	err = editNotmuchConfig(func(lines []string) ([]string, bool) {
+		start, end, found := querySection(lines)
+		if !found {
+			return lines, false
+		}
+
+		i := findQueryKey(lines[start:end], name)
+		if i < 0 {
+			return lines, false
+		}
+
+		deleted = true
+		return append(lines[:start+i], lines[start+i+1:]...), true
+	})
+	return deleted, err
+}
+
+func validateQueryName(name string) error {
+	if name == "" {
+		return fmt.Errorf("query name must not be empty")
+	}
+	if strings.ContainsAny(name, " \t\r\n=[]#;") {
+		return fmt.Errorf("invalid query name: %q", name)
+	}
+	return nil
+}
+
+// returns the range of lines after the [query] header up to the next section
+func querySection(lines []string) (start, end int, found bool) {
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+		if found {
+			return start, i, true
+		}
+		if line == "[query]" {
+			start, found = i+1, true
+		}
+	}
+	return start, len(lines), found
+}
+
+// returns the index of the line defining the key, or -1
+func findQueryKey(lines []string, name string) int {
+	for i, line := range lines {
+		if isBlankOrComment(line) {
+			continue
+		}
+		key, _, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(key) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func isBlankOrComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";")
+}
+
+// Reads the config, passes its lines to edit, and writes the result if edit
+// reports a change. The file is replaced atomically. Symlinks are followed,
+// so that a config kept in a dotfiles repository stays a link. The shared
+// database is opened again on the next read, see database.go.
+func editNotmuchConfig(edit func(lines []string) ([]string, bool)) error {
+	configPath, err := NotmuchConfigLocation()
+	if err != nil {
+		return fmt.Errorf("cannot find config file: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(configPath); err == nil {
+		configPath = resolved
+	}
+
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %v", err)
+	}
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if len(content) == 0 {
+		lines = nil
+	}
+	lines, changed := edit(lines)
+	if !changed {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(configPath), ".notmuch-config-*")
+	if err != nil {
+		return fmt.Errorf("cannot write config file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(strings.Join(lines, "\n") + "\n")
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write config file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), configPath); err != nil {
+		return fmt.Errorf("cannot write config file: %v", err)
+	}
+
+	// notmuch reads the config when the database is opened, e.g., the saved
+	// queries that `query:NAME` refers to
+	CloseDatabase()
+	return nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vrld/ansicht/internal/model"
+	notmuch "github.com/zenhack/go.notmuch"
+)
+
+type testMessage struct {
+	ID   model.MessageID
+	Tags []string
+}
+
+// Creates a notmuch database with the messages in a temporary directory, and
+// points NOTMUCH_CONFIG to its config. The shared database is closed before
+// and after the test.
+func newTestDatabase(t *testing.T, messages ...testMessage) {
+	t.Helper()
+
+	dir := t.TempDir()
+	mailPath := filepath.Join(dir, "mail")
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(mailPath, sub), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configPath := filepath.Join(dir, "config")
+	config := fmt.Sprintf("[database]\npath=%s\n\n[maildir]\nsynchronize_flags=false\n", mailPath)
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NOTMUCH_CONFIG", configPath)
+	t.Setenv("NOTMUCH_DATABASE", "")
+	t.Setenv("NOTMUCH_PROFILE", "")
+
+	resetSharedDatabase()
+	t.Cleanup(resetSharedDatabase)
+
+	db, err := notmuch.Create(mailPath)
+	if err != nil {
+		t.Fatalf("cannot create notmuch database: %v", err)
+	}
+	defer db.Close()
+
+	for i, message := range messages {
+		filename := filepath.Join(mailPath, "cur", fmt.Sprintf("%d:2,S", i))
+		content := fmt.Sprintf("From: Sender <sender@example.org>\n"+
+			"To: recipient@example.org\n"+
+			"Subject: message %d\n"+
+			"Date: Sat, 17 Oct 2026 12:00:00 +0000\n"+
+			"Message-ID: <%s>\n\nbody\n", i, message.ID)
+		if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		nmMessage, err := db.AddMessage(filename)
+		if err != nil {
+			t.Fatalf("cannot add message %s: %v", message.ID, err)
+		}
+		for _, tag := range message.Tags {
+			if err := nmMessage.AddTag(tag); err != nil {
+				t.Fatalf("cannot tag message %s: %v", message.ID, err)
+			}
+		}
+		nmMessage.Close()
+	}
+}
+
+func resetSharedDatabase() {
+	CloseDatabase()
+
+	readOnly.mutex.Lock()
+	defer readOnly.mutex.Unlock()
+	readOnly.xapianDir = ""
+}
+
+// returns the IDs of the messages matching the query, sorted
+func findMessageIDs(t *testing.T, query string) []model.MessageID {
+	t.Helper()
+
+	messages, err := FindMessages(&model.SearchQuery{Query: query})
+	if err != nil {
+		t.Fatalf("FindMessages(%q) error = %v", query, err)
+	}
+
+	ids := make([]model.MessageID, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestSavedQueryIsResolvedAfterSaving(t *testing.T) {
+	newTestDatabase(t,
+		testMessage{ID: "a@example.org", Tags: []string{"a"}},
+		testMessage{ID: "b@example.org", Tags: []string{"b"}},
+	)
+
+	// opens the shared database before the query exists
+	if got := findMessageIDs(t, "tag:a"); !slices.Equal(got, []model.MessageID{"a@example.org"}) {
+		t.Fatalf("tag:a = %v", got)
+	}
+
+	if err := SaveQuery("saved", "tag:a"); err != nil {
+		t.Fatalf("SaveQuery() error = %v", err)
+	}
+	if got := findMessageIDs(t, "query:saved"); !slices.Equal(got, []model.MessageID{"a@example.org"}) {
+		t.Errorf("query:saved = %v, want a@example.org", got)
+	}
+
+	if err := SaveQuery("saved", "tag:b"); err != nil {
+		t.Fatalf("SaveQuery() error = %v", err)
+	}
+	if got := findMessageIDs(t, "query:saved"); !slices.Equal(got, []model.MessageID{"b@example.org"}) {
+		t.Errorf("query:saved = %v after replacing the query, want b@example.org", got)
+	}
+
+	deleted, err := DeleteQuery("saved")
+	if err != nil || !deleted {
+		t.Fatalf("DeleteQuery() = %v, %v", deleted, err)
+	}
+	config, err := os.ReadFile(os.Getenv("NOTMUCH_CONFIG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(config), "saved=") {
+		t.Errorf("config still contains the query:\n%s", config)
+	}
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	notmuch "github.com/zenhack/go.notmuch"
+)
+
+// All reads share one read-only database handle, so that searches do not
+// open the database each time. Access is serialised, because notmuch objects
+// are not safe for concurrent use. The handle is replaced when the Xapian
+// database was modified since it was opened, or when a read fails with a
+// Xapian exception, e.g., a DatabaseModifiedError. Handles that are still in
+// use, e.g., by a ThreadStream, are closed when they are released.
+//
+// Whether the database was modified is decided by the modification time of the
+// files in the Xapian directory, see DatabaseModified, not by the lastmod
+// revision of notmuch, which go.notmuch does not expose. Without a Xapian
+// directory, only the Xapian exception leads to a reopen.
+
+type readOnlyDatabase struct {
+	mutex     sync.Mutex
+	handle    *databaseHandle
+	xapianDir string
+}
+
+type databaseHandle struct {
+	db       *notmuch.DB
+	modified time.Time // modification time of the Xapian database when it was opened
+	users    int
+	replaced bool
+}
+
+var readOnly readOnlyDatabase
+
+// Calls f with the shared database. If f fails with a Xapian exception, the
+// database is opened again and f is called once more.
+func withDatabase(f func(db *notmuch.DB) error) error {
+	readOnly.mutex.Lock()
+	defer readOnly.mutex.Unlock()
+
+	handle, err := readOnly.current()
+	if err != nil {
+		return err
+	}
+
+	err = f(handle.db)
+	if errors.Is(err, notmuch.ErrXapianException) {
+		readOnly.replace()
+		if handle, err = readOnly.current(); err != nil {
+			return err
+		}
+		err = f(handle.db)
+	}
+	return err
+}
+
+// Returns the shared database for reads that take several calls. The handle
+// stays open until it is released, even if the database is opened again in
+// the meantime.
+func acquireDatabase() (*databaseHandle, error) {
+	readOnly.mutex.Lock()
+	defer readOnly.mutex.Unlock()
+
+	handle, err := readOnly.current()
+	if err != nil {
+		return nil, err
+	}
+	handle.users++
+	return handle, nil
+}
+
+func (h *databaseHandle) release() {
+	readOnly.mutex.Lock()
+	defer readOnly.mutex.Unlock()
+
+	h.users--
+	if h.replaced && h.users == 0 {
+		h.db.Close()
+	}
+}
+
+// Calls f with the database of the handle. Access is serialised with all other reads.
+// The handle is replaced for future reads if f fails with a Xapian exception.
+func (h *databaseHandle) with(f func(db *notmuch.DB) error) error {
+	readOnly.mutex.Lock()
+	defer readOnly.mutex.Unlock()
+
+	err := f(h.db)
+	if errors.Is(err, notmuch.ErrXapianException) && readOnly.handle == h {
+		readOnly.replace()
+	}
+	return err
+}
+
+// Closes the shared database. It is opened again by the next read.
+func CloseDatabase() {
+	readOnly.mutex.Lock()
+	defer readOnly.mutex.Unlock()
+
+	readOnly.replace()
+}
+
+// returns the current handle, and opens the database if needed; mutex must be held
+func (r *readOnlyDatabase) current() (*databaseHandle, error) {
+	if r.handle != nil {
+		if r.xapianDir == "" {
+			// cannot tell whether the database changed: keep the handle, reads
+			// that fail with a Xapian exception open the database again
+			return r.handle, nil
+		}
+		modified, err := DatabaseModified(r.xapianDir)
+		if err != nil || !modified.After(r.handle.modified) {
+			return r.handle, nil
+		}
+		r.replace()
+	}
+
+	// read before opening: a change in between leads to another reopen, but is never missed
+	modified, _ := DatabaseModified(r.xapianDir)
+
+	db, err := notmuch.OpenWithConfig(nil, nil, nil, notmuch.DBReadOnly)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open notmuch database: %v", err)
+	}
+
+	if r.xapianDir == "" {
+		if r.xapianDir, err = xapianDirectory(db.Path()); err == nil {
+			modified, _ = DatabaseModified(r.xapianDir)
+		}
+	}
+
+	r.handle = &databaseHandle{db: db, modified: modified}
+	return r.handle, nil
+}
+
+// drops the current handle, which is closed as soon as it is unused; mutex must be held
+func (r *readOnlyDatabase) replace() {
+	if r.handle == nil {
+		return
+	}
+
+	r.handle.replaced = true
+	if r.handle.users == 0 {
+		r.handle.db.Close()
+	}
+	r.handle = nil
+}
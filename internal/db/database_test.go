@@ -0,0 +1,37 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCurrentKeepsHandleWithoutXapianDirectory(t *testing.T) {
+	tests := []struct {
+		name      string
+		xapianDir string
+	}{
+		{"unknown directory", ""},
+		{"missing directory", filepath.Join(t.TempDir(), "xapian")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the handle has no database: replacing it would close a nil database
+			handle := &databaseHandle{}
+			r := readOnlyDatabase{handle: handle, xapianDir: test.xapianDir}
+
+			for i := 0; i < 2; i++ {
+				got, err := r.current()
+				if err != nil {
+					t.Fatalf("current() error = %v", err)
+				}
+				if got != handle {
+					t.Fatalf("current() call %d returned a new handle", i+1)
+				}
+			}
+			if handle.replaced {
+				t.Errorf("handle was replaced")
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,34 +12,338 @@ import (
 	ini "gopkg.in/ini.v1"
 )
 
+// Reads all threads of the search at once, see StreamThreads
 func FindThreads(query *model.SearchQuery) (model.SearchResult, error) {
-	db, err := notmuch.OpenWithConfig(nil, nil, nil, notmuch.DBReadOnly)
+	stream := StreamThreads(*query)
+	defer stream.Close()
+
+	chunk := stream.Next(math.MaxInt)
+	if chunk.Error != nil {
+		return model.SearchResult{}, chunk.Error
+	}
+	return model.SearchResult{Query: query, Threads: chunk.Threads}, nil
+}
+
+// Applies sort order and excluded tags of the search query
+func configureQuery(notmuchQuery *notmuch.Query, query *model.SearchQuery) error {
+	switch query.Sort {
+	case model.SortOldestFirst:
+		notmuchQuery.SetSortScheme(notmuch.SORT_OLDEST_FIRST)
+	case model.SortMessageID:
+		notmuchQuery.SetSortScheme(notmuch.SORT_MESSAGE_ID)
+	case model.SortUnsorted:
+		notmuchQuery.SetSortScheme(notmuch.SORT_UNSORTED)
+	default:
+		notmuchQuery.SetSortScheme(notmuch.SORT_NEWEST_FIRST)
+	}
+
+	if !query.OmitExcluded {
+		return nil
+	}
+
+	excludeTags, err := ExcludeTags()
+	if err != nil {
+		return err
+	}
+	notmuchQuery.SetExcludeScheme(notmuch.EXCLUDE_TRUE)
+	for _, tag := range excludeTags {
+		if err := notmuchQuery.AddTagExclude(tag); err != nil {
+			return fmt.Errorf("cannot exclude tag %s: %v", tag, err)
+		}
+	}
+	return nil
+}
+
+// Counts the messages matching each query. Offset and limit are ignored.
+func CountMessages(queries []model.SearchQuery) ([]int, error) {
+	return count(queries, (*notmuch.Query).CountMessages)
+}
+
+// Counts the threads matching each query. Offset and limit are ignored.
+func CountThreads(queries []model.SearchQuery) ([]int, error) {
+	return count(queries, (*notmuch.Query).CountThreads)
+}
+
+func count(queries []model.SearchQuery, countQuery func(*notmuch.Query) int) (counts []int, err error) {
+	err = withDatabase(func(db *notmuch.DB) error {
+		counts = make([]int, 0, len(queries))
+		for i := range queries {
+			query := db.NewQuery(queries[i].Query)
+			if query == nil {
+				return fmt.Errorf("cannot create query: %v", queries[i].Query)
+			}
+			if err := configureQuery(query, &queries[i]); err != nil {
+				query.Close()
+				return err
+			}
+			counts = append(counts, countQuery(query))
+			query.Close()
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// Reads the messages that match the query, without the rest of their threads
+func FindMessages(query *model.SearchQuery) (messages []model.Message, err error) {
+	err = withDatabase(func(db *notmuch.DB) error {
+		notmuchQuery := db.NewQuery(query.Query)
+		if notmuchQuery == nil {
+			return fmt.Errorf("cannot create query: %v", query.Query)
+		}
+		defer notmuchQuery.Close()
+		if err := configureQuery(notmuchQuery, query); err != nil {
+			return err
+		}
+
+		nmMessages, err := notmuchQuery.Messages()
+		if err != nil {
+			return fmt.Errorf("cannot get messages: %w", err)
+		}
+
+		messages = nil
+		var nmMessage *notmuch.Message
+		for skipped := 0; nmMessages.Next(&nmMessage); skipped++ {
+			if nmMessage == nil {
+				panic("unexpected nil in messages.Next()")
+			}
+			if skipped < query.Offset {
+				continue
+			}
+
+			messages = append(messages, MessageFromNotmuch(nmMessage))
+			if query.Limit > 0 && len(messages) >= query.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return messages, err
+}
+
+// Re-reads the given messages from the database. Messages that no longer exist
+// or whose thread no longer matches the query are returned in `removed`. Like
+// in search results, messages of a matching thread are kept even if they do
+// not match the query themselves.
+func RefreshMessages(query *model.SearchQuery, ids []model.MessageID) (updated []model.Message, removed []model.MessageID, err error) {
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	idQueries := make([]string, 0, len(ids))
+	for _, id := range ids {
+		idQueries = append(idQueries, IDQuery(id))
+	}
+
+	existing := make(map[model.MessageID]model.Message, len(ids))
+	matchingThreads := make(map[string]bool)
+	err = withDatabase(func(db *notmuch.DB) error {
+		clear(existing)
+		clear(matchingThreads)
+
+		messages, err := findMessages(db, strings.Join(idQueries, " OR "))
+		if err != nil {
+			return err
+		}
+
+		threadQueries := make([]string, 0, len(messages))
+		for _, message := range messages {
+			existing[message.ID] = message
+			if _, seen := matchingThreads[message.ThreadID]; !seen {
+				matchingThreads[message.ThreadID] = false
+				threadQueries = append(threadQueries, "thread:"+message.ThreadID)
+			}
+		}
+		if len(threadQueries) == 0 {
+			return nil
+		}
+
+		queryString := fmt.Sprintf("(%s) AND (%s)", query.Query, strings.Join(threadQueries, " OR "))
+		notmuchQuery := db.NewQuery(queryString)
+		if notmuchQuery == nil {
+			return fmt.Errorf("cannot create query: %v", queryString)
+		}
+		defer notmuchQuery.Close()
+		if err := configureQuery(notmuchQuery, query); err != nil {
+			return err
+		}
+
+		threads, err := notmuchQuery.Threads()
+		if err != nil {
+			return fmt.Errorf("cannot get threads: %w", err)
+		}
+
+		var notmuchThread *notmuch.Thread
+		for threads.Next(&notmuchThread) {
+			if notmuchThread == nil {
+				return fmt.Errorf("unexpected nil in threads.Next()")
+			}
+			matchingThreads[notmuchThread.ID()] = true
+		}
+		return nil
+	})
 	if err != nil {
-		return model.SearchResult{}, fmt.Errorf("cannot open notmuch database: %v", err)
+		return nil, nil, err
+	}
+
+	for _, id := range ids {
+		if message, ok := existing[id]; ok && matchingThreads[message.ThreadID] {
+			updated = append(updated, message)
+		} else {
+			removed = append(removed, id)
+		}
 	}
-	defer db.Close()
 
-	notmuchQuery := db.NewQuery(query.Query)
+	return updated, removed, nil
+}
+
+// reads the messages that match the query, in any order
+func findMessages(db *notmuch.DB, queryString string) ([]model.Message, error) {
+	notmuchQuery := db.NewQuery(queryString)
 	if notmuchQuery == nil {
-		return model.SearchResult{}, fmt.Errorf("cannot create query: %v", query.Query)
+		return nil, fmt.Errorf("cannot create query: %v", queryString)
 	}
+	defer notmuchQuery.Close()
+	notmuchQuery.SetSortScheme(notmuch.SORT_UNSORTED)
 
-	threads, err := notmuchQuery.Threads()
+	nmMessages, err := notmuchQuery.Messages()
 	if err != nil {
-		return model.SearchResult{}, fmt.Errorf("cannot get threads: %v", err)
+		return nil, fmt.Errorf("cannot get messages: %w", err)
+	}
+
+	var messages []model.Message
+	var nmMessage *notmuch.Message
+	for nmMessages.Next(&nmMessage) {
+		if nmMessage == nil {
+			return nil, fmt.Errorf("unexpected nil in messages.Next()")
+		}
+		messages = append(messages, MessageFromNotmuch(nmMessage))
 	}
+	return messages, nil
+}
+
+// Returns a query term that matches exactly the message with the given ID.
+func IDQuery(id model.MessageID) string {
+	return `id:"` + strings.ReplaceAll(string(id), `"`, `""`) + `"`
+}
+
+// Reads a thread and its messages as a reply tree, in depth-first order.
+func FindThreadTree(threadID string) (thread model.Thread, nodes []model.ThreadNode, err error) {
+	err = withDatabase(func(db *notmuch.DB) error {
+		notmuchQuery := db.NewQuery("thread:" + threadID)
+		if notmuchQuery == nil {
+			return fmt.Errorf("cannot create query for thread: %v", threadID)
+		}
+		defer notmuchQuery.Close()
 
-	var notmuchThread *notmuch.Thread
-	result := model.SearchResult{Query: query}
-	for threads.Next(&notmuchThread) {
-		if notmuchThread == nil {
-			panic("unexpected nil in threads.Next()")
+		threads, err := notmuchQuery.Threads()
+		if err != nil {
+			return fmt.Errorf("cannot get threads: %w", err)
 		}
 
-		result.Threads = append(result.Threads, ThreadFromNotmuch(notmuchThread))
+		var notmuchThread *notmuch.Thread
+		if !threads.Next(&notmuchThread) || notmuchThread == nil {
+			return fmt.Errorf("thread not found: %v", threadID)
+		}
+
+		thread = ThreadFromNotmuch(notmuchThread)
+		nodes = appendThreadNodes(nil, notmuchThread.TopLevelMessages(), 0)
+		return nil
+	})
+	if err != nil {
+		return model.Thread{}, nil, err
+	}
+
+	return thread, nodes, nil
+}
+
+// Returns the IDs of all messages in the threads
+func ThreadMessageIDs(threadIDs []string) (ids []model.MessageID, err error) {
+	if len(threadIDs) == 0 {
+		return nil, nil
+	}
+
+	terms := make([]string, 0, len(threadIDs))
+	for _, threadID := range threadIDs {
+		terms = append(terms, "thread:"+threadID)
 	}
+	queryString := strings.Join(terms, " OR ")
+
+	err = withDatabase(func(db *notmuch.DB) error {
+		notmuchQuery := db.NewQuery(queryString)
+		if notmuchQuery == nil {
+			return fmt.Errorf("cannot create query: %v", queryString)
+		}
+		defer notmuchQuery.Close()
+
+		nmMessages, err := notmuchQuery.Messages()
+		if err != nil {
+			return fmt.Errorf("cannot get messages: %w", err)
+		}
+
+		ids = nil
+		var nmMessage *notmuch.Message
+		for nmMessages.Next(&nmMessage) {
+			if nmMessage == nil {
+				panic("unexpected nil in messages.Next()")
+			}
+			ids = append(ids, model.MessageID(nmMessage.ID()))
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// Reads a header of the message from its file, e.g., "List-Id".
+// Returns an empty string if the message has no such header.
+func MessageHeader(id model.MessageID, header string) (value string, err error) {
+	err = withMessage(id, func(nmMessage *notmuch.Message) {
+		value = nmMessage.Header(header)
+	})
+	return value, err
+}
+
+// Returns all files of the message, which are several if the message is duplicated.
+func MessageFilenames(id model.MessageID) (filenames []model.Filename, err error) {
+	err = withMessage(id, func(nmMessage *notmuch.Message) {
+		filenames = nil
+		nmFilenames := nmMessage.Filenames()
+		var filename string
+		for nmFilenames.Next(&filename) {
+			filenames = append(filenames, model.Filename(filename))
+		}
+	})
+	return filenames, err
+}
+
+func withMessage(id model.MessageID, f func(nmMessage *notmuch.Message)) error {
+	return withDatabase(func(db *notmuch.DB) error {
+		nmMessage, err := db.FindMessage(string(id))
+		if err != nil {
+			return fmt.Errorf("cannot find message %s: %w", id, err)
+		}
+		defer nmMessage.Close()
+
+		f(nmMessage)
+		return nil
+	})
+}
+
+func appendThreadNodes(nodes []model.ThreadNode, nmMessages *notmuch.Messages, depth int) []model.ThreadNode {
+	var nmMessage *notmuch.Message
+	for nmMessages.Next(&nmMessage) {
+		if nmMessage == nil {
+			panic("unexpected nil in messages.Next()")
+		}
+
+		nodes = append(nodes, model.ThreadNode{Message: MessageFromNotmuch(nmMessage), Depth: depth})
 
-	return result, nil
+		// Replies() fails if there are no replies
+		if replies, err := nmMessage.Replies(); err == nil {
+			nodes = appendThreadNodes(nodes, replies, depth+1)
+		}
+	}
+	return nodes
 }
 
 func ThreadFromNotmuch(nmThread *notmuch.Thread) model.Thread {
@@ -82,6 +387,19 @@ func MessageFromNotmuch(nmMessage *notmuch.Message) model.Message {
 	}
 }
 
+// Returns all tags used in the database
+func AllTags() (tags []string, err error) {
+	err = withDatabase(func(db *notmuch.DB) error {
+		nmTags, err := db.Tags()
+		if err != nil {
+			return fmt.Errorf("cannot get tags: %w", err)
+		}
+		tags = ReadTags(nmTags)
+		return nil
+	})
+	return tags, err
+}
+
 func ReadTags(nmTags *notmuch.Tags) []string {
 	var tags []string
 	var nmTag *notmuch.Tag
@@ -131,14 +449,9 @@ func GetSavedQueries() ([]model.SearchQuery, error) {
 	// Next() always returned false
 	//
 	// So we just parse the config file ourselves.
-	configPath, err := NotmuchConfigLocation()
-	if err != nil {
-		return nil, fmt.Errorf("cannot find config file: %v", err)
-	}
-
-	config, err := ini.Load(configPath)
+	config, err := loadNotmuchConfig()
 	if err != nil {
-		return nil, fmt.Errorf("cannot load config file from %s: %v", configPath, err)
+		return nil, err
 	}
 
 	querySection, err := config.GetSection("query")
@@ -158,6 +471,43 @@ func GetSavedQueries() ([]model.SearchQuery, error) {
 	return queries, nil
 }
 
+// Returns the tags in search.exclude_tags of the notmuch config
+func ExcludeTags() ([]string, error) {
+	config, err := loadNotmuchConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(config.Section("search").Key("exclude_tags").String(), ";") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// The notmuch config is a GLib key file: comments take whole lines, and
+// values are never quoted and may contain ; and #.
+var notmuchConfigOptions = ini.LoadOptions{
+	IgnoreInlineComment:     true,
+	PreserveSurroundedQuote: true,
+}
+
+func loadNotmuchConfig() (*ini.File, error) {
+	configPath, err := NotmuchConfigLocation()
+	if err != nil {
+		return nil, fmt.Errorf("cannot find config file: %v", err)
+	}
+
+	config, err := ini.LoadSources(notmuchConfigOptions, configPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load config file from %s: %v", configPath, err)
+	}
+
+	return config, nil
+}
+
 func NotmuchConfigLocation() (string, error) {
 	// Search order as specified in man notmuch-config
 	if notmuchConfig := os.Getenv("NOTMUCH_CONFIG"); notmuchConfig != "" {
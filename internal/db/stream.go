@@ -0,0 +1,243 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vrld/ansicht/internal/model"
+	notmuch "github.com/zenhack/go.notmuch"
+)
+
+// Number of threads that are read at once when streaming search results
+const ThreadChunkSize = 100
+
+type ThreadChunk struct {
+	Threads []model.Thread
+	Done    bool // there are no more threads, or the stream was closed
+	Error   error
+}
+
+// Reads the threads of a search in chunks, so that the first threads can be
+// shown before all of them are read. The shared database stays acquired until
+// the last chunk was read or Close is called, see database.go.
+type ThreadStream struct {
+	query    model.SearchQuery
+	requests chan int
+	chunks   chan ThreadChunk
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func StreamThreads(query model.SearchQuery) *ThreadStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &ThreadStream{
+		query:    query,
+		requests: make(chan int),
+		chunks:   make(chan ThreadChunk),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	go stream.run()
+	return stream
+}
+
+func (s *ThreadStream) Query() model.SearchQuery {
+	return s.query
+}
+
+// Returns at most n of the next threads. Blocks until the threads are read,
+// or the stream is closed.
+func (s *ThreadStream) Next(n int) ThreadChunk {
+	select {
+	case s.requests <- n:
+	case <-s.ctx.Done():
+		return ThreadChunk{Done: true}
+	}
+
+	select {
+	case chunk := <-s.chunks:
+		return chunk
+	case <-s.ctx.Done():
+		return ThreadChunk{Done: true}
+	}
+}
+
+// Stops reading threads, also when called during Next
+func (s *ThreadStream) Close() {
+	s.cancel()
+}
+
+// how often a stream is restarted after the database was modified while reading
+const maxStreamRestarts = 3
+
+// an open search on an acquired database handle
+type threadIterator struct {
+	handle  *databaseHandle
+	query   *notmuch.Query
+	threads *notmuch.Threads
+}
+
+func (it *threadIterator) close() {
+	it.handle.with(func(*notmuch.DB) error {
+		return it.query.Close()
+	})
+	it.handle.release()
+}
+
+// reads threads on request until the threads are exhausted or the stream is closed
+func (s *ThreadStream) run() {
+	defer s.cancel()
+
+	var n int
+	select {
+	case n = <-s.requests:
+	case <-s.ctx.Done():
+		return
+	}
+
+	var it *threadIterator
+	defer func() {
+		if it != nil {
+			it.close()
+		}
+	}()
+
+	// consumed counts the threads read from the current search, including
+	// those skipped for the offset. A restarted search reads from the start
+	// again, because threads may have been added or sorted differently since,
+	// and skips the threads that were read before.
+	consumed, read, restarts := 0, 0, 0
+	seen := make(map[string]bool)
+	var chunk ThreadChunk
+	for {
+		if it == nil {
+			var err error
+			if it, consumed, err = s.search(s.query.Offset); err != nil {
+				s.send(ThreadChunk{Threads: chunk.Threads, Done: true, Error: err})
+				return
+			}
+		}
+
+		truncated := false
+		err := it.handle.with(func(*notmuch.DB) error {
+			var notmuchThread *notmuch.Thread
+			for len(chunk.Threads) < n {
+				if s.ctx.Err() != nil {
+					return nil
+				}
+				if s.query.Limit > 0 && read >= s.query.Limit {
+					chunk.Done = true
+					return nil
+				}
+				if !it.threads.Next(&notmuchThread) {
+					// libnotmuch also ends the threads on an exception, e.g., when
+					// the database was modified since the handle was opened. Then
+					// the count differs, too, as it is zero if counting failed.
+					truncated = it.query.CountThreads() != consumed
+					chunk.Done = !truncated
+					return nil
+				}
+				if notmuchThread == nil {
+					return fmt.Errorf("unexpected nil in threads.Next()")
+				}
+
+				consumed++
+				if consumed <= s.query.Offset {
+					continue
+				}
+				id := notmuchThread.ID()
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				chunk.Threads = append(chunk.Threads, ThreadFromNotmuch(notmuchThread))
+				read++
+			}
+			return nil
+		})
+
+		if err != nil || truncated {
+			// continue on a fresh handle
+			it.close()
+			it = nil
+			if restarts++; restarts > maxStreamRestarts {
+				if err == nil {
+					err = fmt.Errorf("search results changed while reading: %v", s.query.Query)
+				}
+				s.send(ThreadChunk{Threads: chunk.Threads, Done: true, Error: err})
+				return
+			}
+			continue
+		}
+
+		if s.ctx.Err() != nil || !s.send(chunk) || chunk.Done {
+			return
+		}
+		chunk = ThreadChunk{}
+
+		select {
+		case n = <-s.requests:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// Runs the query on the shared database, which stays acquired until the
+// iterator is closed, and skips the first threads. Returns the number of
+// skipped threads, which is less if there are fewer threads now. Retries once
+// if the database was modified since it was opened.
+func (s *ThreadStream) search(skip int) (*threadIterator, int, error) {
+	it, skipped, err := s.searchOnce(skip)
+	if errors.Is(err, notmuch.ErrXapianException) {
+		it, skipped, err = s.searchOnce(skip)
+	}
+	return it, skipped, err
+}
+
+func (s *ThreadStream) searchOnce(skip int) (*threadIterator, int, error) {
+	handle, err := acquireDatabase()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	it := &threadIterator{handle: handle}
+	skipped := 0
+	err = handle.with(func(db *notmuch.DB) error {
+		it.query = db.NewQuery(s.query.Query)
+		if it.query == nil {
+			return fmt.Errorf("cannot create query: %v", s.query.Query)
+		}
+		if err := configureQuery(it.query, &s.query); err != nil {
+			it.query.Close()
+			return err
+		}
+
+		it.threads, err = it.query.Threads()
+		if err != nil {
+			it.query.Close()
+			return fmt.Errorf("cannot get threads: %w", err)
+		}
+
+		var notmuchThread *notmuch.Thread
+		for skipped < skip && it.threads.Next(&notmuchThread) {
+			skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		handle.release()
+		return nil, 0, err
+	}
+	return it, skipped, nil
+}
+
+func (s *ThreadStream) send(chunk ThreadChunk) bool {
+	select {
+	case s.chunks <- chunk:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/vrld/ansicht/internal/model"
+	notmuch "github.com/zenhack/go.notmuch"
+)
+
+type TagChange struct {
+	Tag    string
+	Remove bool
+}
+
+func (c TagChange) String() string {
+	if c.Remove {
+		return "-" + c.Tag
+	}
+	return "+" + c.Tag
+}
+
+// Parses tag operations in the format of `notmuch tag`: +tag adds, -tag removes.
+// Surrounding whitespace is ignored, as are empty arguments.
+func ParseTagChanges(args []string) ([]TagChange, error) {
+	changes := make([]TagChange, 0, len(args))
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+
+		var change TagChange
+		switch arg[0] {
+		case '+':
+			change.Tag = arg[1:]
+		case '-':
+			change.Tag = arg[1:]
+			change.Remove = true
+		default:
+			return nil, fmt.Errorf("tag change must start with + or -: %s", arg)
+		}
+
+		if change.Tag == "" {
+			return nil, fmt.Errorf("empty tag in: %s", arg)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// Applies the tag changes to all messages within one atomic section of the
+// database: if tagging fails on any message, no message is changed. All
+// messages are looked up first, so an unknown ID changes nothing either.
+// Maildir flags are synchronized after the changes were committed: a failure
+// there keeps the new tags and returns a *MaildirFlagsError. The shared database is opened again on the
+// next read. Returns the number of messages whose tags were actually changed.
+func TagMessages(ids []model.MessageID, changes []TagChange) (int, error) {
+	if len(ids) == 0 || len(changes) == 0 {
+		return 0, nil
+	}
+
+	synchronizeFlags := SynchronizeMaildirFlags()
+
+	db, err := notmuch.OpenWithConfig(nil, nil, nil, notmuch.DBReadWrite)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open notmuch database: %v", err)
+	}
+	defer db.Close()
+
+	messages := make([]*notmuch.Message, 0, len(ids))
+	defer func() {
+		for _, message := range messages {
+			message.Close()
+		}
+	}()
+	for _, id := range ids {
+		message, err := db.FindMessage(string(id))
+		if err != nil {
+			return 0, fmt.Errorf("cannot find message %s: %v", id, err)
+		}
+		messages = append(messages, message)
+	}
+
+	var changed []int
+	err = atomically(db, func() error {
+		for i, message := range messages {
+			wasChanged, err := tagMessage(message, ids[i], changes)
+			if err != nil {
+				return err
+			}
+			if wasChanged {
+				changed = append(changed, i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// the shared database reads the new tags, even if the Xapian directory is
+	// unknown or its modification time did not change, see database.go
+	defer CloseDatabase()
+
+	if synchronizeFlags {
+		var flagsErr *MaildirFlagsError
+		for _, i := range changed {
+			if err := messages[i].TagsToMaildirFlags(); err != nil {
+				if flagsErr == nil {
+					flagsErr = &MaildirFlagsError{Err: err}
+				}
+				flagsErr.IDs = append(flagsErr.IDs, ids[i])
+			}
+		}
+		if flagsErr != nil {
+			return len(changed), flagsErr
+		}
+	}
+
+	return len(changed), nil
+}
+
+// Returned by TagMessages if the tags were changed, but the maildir flags of
+// some messages could not be synchronized
+type MaildirFlagsError struct {
+	IDs []model.MessageID
+	Err error // the first error
+}
+
+func (e *MaildirFlagsError) Error() string {
+	if len(e.IDs) == 1 {
+		return fmt.Sprintf("tagged, but cannot synchronize maildir flags of %s: %v", e.IDs[0], e.Err)
+	}
+	return fmt.Sprintf("tagged, but cannot synchronize maildir flags of %d messages: %v", len(e.IDs), e.Err)
+}
+
+func (e *MaildirFlagsError) Unwrap() error {
+	return e.Err
+}
+
+// aborts the atomic section of atomically
+type atomicAbort struct {
+	err error
+}
+
+// Runs f within an atomic section of the database. If f fails, the database is
+// closed within the section, which discards the changes of f: db.Atomic would
+// end the section and thereby commit them, so f's error leaves the section as
+// a panic. The database must not be used after an error.
+func atomically(db *notmuch.DB, f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			abort, ok := r.(atomicAbort)
+			if !ok {
+				panic(r)
+			}
+			db.Close()
+			err = abort.err
+		}
+	}()
+
+	err = db.Atomic(func(*notmuch.DB) {
+		if err := f(); err != nil {
+			panic(atomicAbort{err})
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("cannot apply tag changes: %v", err)
+	}
+	return nil
+}
+
+func tagMessage(message *notmuch.Message, id model.MessageID, changes []TagChange) (bool, error) {
+	tags := ReadTags(message.Tags())
+
+	var changed bool
+	var tagErr error
+	err := message.Atomic(func(message *notmuch.Message) {
+		for _, change := range changes {
+			hasTag := slices.Contains(tags, change.Tag)
+			if change.Remove && hasTag {
+				if tagErr = message.RemoveTag(change.Tag); tagErr != nil {
+					return
+				}
+				tags = slices.DeleteFunc(tags, func(t string) bool { return t == change.Tag })
+				changed = true
+			} else if !change.Remove && !hasTag {
+				if tagErr = message.AddTag(change.Tag); tagErr != nil {
+					return
+				}
+				tags = append(tags, change.Tag)
+				changed = true
+			}
+		}
+	})
+	if tagErr != nil {
+		return changed, fmt.Errorf("cannot tag message %s: %v", id, tagErr)
+	}
+	if err != nil {
+		return changed, fmt.Errorf("cannot tag message %s: %v", id, err)
+	}
+
+	return changed, nil
+}
+
+// Reads maildir.synchronize_flags from the notmuch config. Notmuch
+// synchronizes flags unless told otherwise, so this defaults to true.
+func SynchronizeMaildirFlags() bool {
+	config, err := loadNotmuchConfig()
+	if err != nil {
+		return true
+	}
+
+	return config.Section("maildir").Key("synchronize_flags").MustBool(true)
+}
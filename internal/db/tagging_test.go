@@ -0,0 +1,133 @@
+package db
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vrld/ansicht/internal/model"
+)
+
+func TestParseTagChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []TagChange
+		wantErr bool
+	}{
+		{"empty", nil, []TagChange{}, false},
+		{"add", []string{"+inbox"}, []TagChange{{Tag: "inbox"}}, false},
+		{"remove", []string{"-unread"}, []TagChange{{Tag: "unread", Remove: true}}, false},
+		{
+			"mixed in order",
+			[]string{"+archive", "-inbox", "+archive"},
+			[]TagChange{{Tag: "archive"}, {Tag: "inbox", Remove: true}, {Tag: "archive"}},
+			false,
+		},
+		{"whitespace is trimmed", []string{"  +todo\t"}, []TagChange{{Tag: "todo"}}, false},
+		{"empty arguments are skipped", []string{"", "  ", "-spam"}, []TagChange{{Tag: "spam", Remove: true}}, false},
+		{"tag keeps inner characters", []string{"+a-b+c"}, []TagChange{{Tag: "a-b+c"}}, false},
+		{"missing prefix", []string{"inbox"}, nil, true},
+		{"empty tag", []string{"+"}, nil, true},
+		{"empty tag after valid change", []string{"+inbox", "-"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseTagChanges(test.args)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseTagChanges(%q) error = %v, wantErr %v", test.args, err, test.wantErr)
+			}
+			if !test.wantErr && !slices.Equal(got, test.want) {
+				t.Errorf("ParseTagChanges(%q) = %v, want %v", test.args, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTagChangeString(t *testing.T) {
+	if got := (TagChange{Tag: "inbox"}).String(); got != "+inbox" {
+		t.Errorf("String() = %q, want +inbox", got)
+	}
+	if got := (TagChange{Tag: "inbox", Remove: true}).String(); got != "-inbox" {
+		t.Errorf("String() = %q, want -inbox", got)
+	}
+}
+
+// returns the tags of the message, sorted
+func messageTags(t *testing.T, id model.MessageID) []string {
+	t.Helper()
+
+	messages, err := FindMessages(&model.SearchQuery{Query: IDQuery(id)})
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("cannot find message %s: %v", id, err)
+	}
+	tags := slices.Clone(messages[0].Tags)
+	slices.Sort(tags)
+	return tags
+}
+
+func TestTagMessages(t *testing.T) {
+	newTestDatabase(t,
+		testMessage{ID: "a@example.org", Tags: []string{"inbox", "unread"}},
+		testMessage{ID: "b@example.org", Tags: []string{"inbox"}},
+	)
+
+	// opens the shared database before tagging
+	if got := messageTags(t, "a@example.org"); !slices.Equal(got, []string{"inbox", "unread"}) {
+		t.Fatalf("tags of a = %v before tagging", got)
+	}
+
+	ids := []model.MessageID{"a@example.org", "b@example.org"}
+	changed, err := TagMessages(ids, []TagChange{{Tag: "unread", Remove: true}})
+	if err != nil {
+		t.Fatalf("TagMessages() error = %v", err)
+	}
+	if changed != 1 {
+		t.Errorf("TagMessages() = %d, want 1", changed)
+	}
+
+	if got := messageTags(t, "a@example.org"); !slices.Equal(got, []string{"inbox"}) {
+		t.Errorf("tags of a = %v, want [inbox]", got)
+	}
+	if got := messageTags(t, "b@example.org"); !slices.Equal(got, []string{"inbox"}) {
+		t.Errorf("tags of b = %v, want [inbox]", got)
+	}
+}
+
+func TestTagMessagesChangesNothingOnError(t *testing.T) {
+	newTestDatabase(t,
+		testMessage{ID: "a@example.org", Tags: []string{"inbox"}},
+		testMessage{ID: "b@example.org", Tags: []string{"inbox"}},
+	)
+
+	// notmuch refuses tags longer than NOTMUCH_TAG_MAX (200 bytes), after the
+	// first change was made to the first message
+	changes := []TagChange{{Tag: "inbox", Remove: true}, {Tag: strings.Repeat("x", 201)}}
+	ids := []model.MessageID{"a@example.org", "b@example.org"}
+	changed, err := TagMessages(ids, changes)
+	if err == nil {
+		t.Fatalf("TagMessages() did not fail")
+	}
+	if changed != 0 {
+		t.Errorf("TagMessages() = %d, want 0", changed)
+	}
+
+	for _, id := range ids {
+		if got := messageTags(t, id); !slices.Equal(got, []string{"inbox"}) {
+			t.Errorf("tags of %s = %v, want [inbox]", id, got)
+		}
+	}
+}
+
+func TestTagMessagesUnknownID(t *testing.T) {
+	newTestDatabase(t, testMessage{ID: "a@example.org", Tags: []string{"inbox"}})
+
+	ids := []model.MessageID{"a@example.org", "unknown@example.org"}
+	if _, err := TagMessages(ids, []TagChange{{Tag: "inbox", Remove: true}}); err == nil {
+		t.Fatalf("TagMessages() did not fail")
+	}
+	if got := messageTags(t, "a@example.org"); !slices.Equal(got, []string{"inbox"}) {
+		t.Errorf("tags of a = %v, want [inbox]", got)
+	}
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	notmuch "github.com/zenhack/go.notmuch"
+)
+
+// Returns the directory of the Xapian database, which is written whenever
+// messages are added, removed or tagged.
+func XapianDirectory() (string, error) {
+	var mailPath string
+	err := withDatabase(func(db *notmuch.DB) error {
+		mailPath = db.Path()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return xapianDirectory(mailPath)
+}
+
+func xapianDirectory(mailPath string) (string, error) {
+	candidates := configuredXapianDirectories()
+	candidates = append(candidates, filepath.Join(mailPath, ".notmuch", "xapian"))
+
+	// split configuration, see man notmuch-config
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+	}
+	profile := os.Getenv("NOTMUCH_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	candidates = append(candidates, filepath.Join(dataHome, "notmuch", profile, "xapian"))
+
+	for _, dir := range candidates {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find Xapian database in %v", candidates)
+}
+
+// Returns where database.path of the notmuch config puts the Xapian database:
+// in <path>/xapian if database.mail_root is set to another directory, else in
+// <path>/.notmuch/xapian, see man notmuch-config. NOTMUCH_DATABASE overrides
+// database.path.
+func configuredXapianDirectories() []string {
+	config, err := loadNotmuchConfig()
+	if err != nil {
+		return nil
+	}
+	database := config.Section("database")
+
+	path := os.Getenv("NOTMUCH_DATABASE")
+	if path == "" {
+		path = database.Key("path").String()
+	}
+	if path = configuredPath(path); path == "" {
+		return nil
+	}
+
+	mailRoot := configuredPath(database.Key("mail_root").String())
+	if mailRoot == "" || mailRoot == path {
+		return []string{filepath.Join(path, ".notmuch", "xapian"), filepath.Join(path, "xapian")}
+	}
+	return []string{filepath.Join(path, "xapian"), filepath.Join(path, ".notmuch", "xapian")}
+}
+
+// relative paths in the notmuch config are relative to the home directory
+func configuredPath(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return ""
+	}
+	if !filepath.IsAbs(path) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		path = filepath.Join(home, path)
+	}
+	return filepath.Clean(path)
+}
+
+// Returns the latest modification time of the files in the Xapian directory.
+// This approximates the lastmod revision of the database, which go.notmuch does
+// not expose: writes change the files, but a change within the timestamp
+// resolution of the file system may be missed until the next write.
+func DatabaseModified(xapianDir string) (time.Time, error) {
+	entries, err := os.ReadDir(xapianDir)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot read database directory: %v", err)
+	}
+
+	var modified time.Time
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed while reading the directory
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	return modified, nil
+}
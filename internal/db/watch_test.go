@@ -0,0 +1,57 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestXapianDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string // database.path, relative to the temporary directory
+		mailRoot string // database.mail_root, empty if not set
+		want     string // the Xapian directory that is created
+	}{
+		{"path only", "mail", "", "mail/.notmuch/xapian"},
+		{"mail_root equals path", "mail", "mail", "mail/.notmuch/xapian"},
+		{"split path and mail_root", "index", "mail", "index/xapian"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+			t.Setenv("NOTMUCH_DATABASE", "")
+			t.Setenv("NOTMUCH_PROFILE", "")
+
+			config := fmt.Sprintf("[database]\npath=%s\n", filepath.Join(dir, test.database))
+			if test.mailRoot != "" {
+				config += fmt.Sprintf("mail_root=%s\n", filepath.Join(dir, test.mailRoot))
+			}
+			configPath := filepath.Join(dir, "config")
+			if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("NOTMUCH_CONFIG", configPath)
+
+			want := filepath.Join(dir, test.want)
+			if err := os.MkdirAll(want, 0o700); err != nil {
+				t.Fatal(err)
+			}
+
+			mailRoot := filepath.Join(dir, test.mailRoot)
+			if test.mailRoot == "" {
+				mailRoot = filepath.Join(dir, test.database)
+			}
+			got, err := xapianDirectory(mailRoot)
+			if err != nil {
+				t.Fatalf("xapianDirectory() error = %v", err)
+			}
+			if got != want {
+				t.Errorf("xapianDirectory() = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package email
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/vrld/ansicht/internal/model"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+type Header struct {
+	Name  string
+	Value string
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Size        int
+}
+
+// Content is the readable part of a message
+type Content struct {
+	Headers     []Header
+	Body        string
+	Attachments []Attachment
+}
+
+// headers shown above the body, in this order
+var displayedHeaders = []string{"Date", "From", "To", "Cc", "Subject"}
+
+var wordDecoder = mime.WordDecoder{CharsetReader: charsetReader}
+
+// Reads and decodes the message stored in the given file.
+func ReadFile(filename model.Filename) (*Content, error) {
+	file, err := os.Open(string(filename))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open message: %v", err)
+	}
+	defer file.Close()
+
+	message, err := mail.ReadMessage(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse message: %v", err)
+	}
+
+	content := &Content{}
+	for _, name := range displayedHeaders {
+		if value := message.Header.Get(name); value != "" {
+			content.Headers = append(content.Headers, Header{Name: name, Value: DecodeHeader(value)})
+		}
+	}
+
+	part := mimePart{
+		contentType:      message.Header.Get("Content-Type"),
+		transferEncoding: message.Header.Get("Content-Transfer-Encoding"),
+		body:             message.Body,
+	}
+	if err := content.readPart(part); err != nil {
+		return content, err
+	}
+
+	return content, nil
+}
+
+// Decodes RFC 2047 encoded words, e.g. =?utf-8?q?gr=C3=BC=C3=9Fe?=
+func DecodeHeader(value string) string {
+	if decoded, err := wordDecoder.DecodeHeader(value); err == nil {
+		return decoded
+	}
+	return value
+}
+
+type mimePart struct {
+	contentType      string
+	transferEncoding string
+	disposition      string
+	body             io.Reader
+}
+
+func partFromMultipart(p *multipart.Part) mimePart {
+	return mimePart{
+		contentType:      p.Header.Get("Content-Type"),
+		transferEncoding: p.Header.Get("Content-Transfer-Encoding"),
+		disposition:      p.Header.Get("Content-Disposition"),
+		body:             p,
+	}
+}
+
+func (c *Content) readPart(part mimePart) error {
+	mediaType, params, err := mime.ParseMediaType(part.contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(part.disposition)
+	isAttachment := disposition == "attachment"
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/alternative"):
+		return c.readAlternative(part.body, params["boundary"])
+
+	case strings.HasPrefix(mediaType, "multipart/"):
+		reader := multipart.NewReader(part.body, params["boundary"])
+		for {
+			p, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("cannot read multipart message: %v", err)
+			}
+			if err := c.readPart(partFromMultipart(p)); err != nil {
+				return err
+			}
+		}
+
+	case !isAttachment && (mediaType == "text/plain" || mediaType == "text/html"):
+		text, err := decodeText(part, params["charset"])
+		if err != nil {
+			return err
+		}
+		if mediaType == "text/html" {
+			text = htmlToText(text)
+		}
+		c.appendBody(text)
+		return nil
+
+	default:
+		decoded, err := io.ReadAll(decodeTransfer(part))
+		if err != nil {
+			return fmt.Errorf("cannot decode attachment: %v", err)
+		}
+
+		name := dispositionParams["filename"]
+		if name == "" {
+			name = params["name"]
+		}
+		c.Attachments = append(c.Attachments, Attachment{
+			Filename:    DecodeHeader(name),
+			ContentType: mediaType,
+			Size:        len(decoded),
+		})
+		return nil
+	}
+}
+
+// Selects text/plain if present, falls back to the last (richest) alternative
+func (c *Content) readAlternative(body io.Reader, boundary string) error {
+	var alternatives []mimePart
+
+	reader := multipart.NewReader(body, boundary)
+	for {
+		p, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read multipart message: %v", err)
+		}
+
+		// a part is only readable until the next one is requested
+		raw, err := io.ReadAll(p)
+		if err != nil {
+			return fmt.Errorf("cannot read multipart message: %v", err)
+		}
+		alternative := partFromMultipart(p)
+		alternative.body = strings.NewReader(string(raw))
+		alternatives = append(alternatives, alternative)
+	}
+
+	if len(alternatives) == 0 {
+		return nil
+	}
+
+	chosen := alternatives[len(alternatives)-1]
+	for _, alternative := range alternatives {
+		if mediaType, _, _ := mime.ParseMediaType(alternative.contentType); mediaType == "text/plain" {
+			chosen = alternative
+			break
+		}
+	}
+
+	return c.readPart(chosen)
+}
+
+func (c *Content) appendBody(text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if c.Body != "" {
+		c.Body += "\n\n"
+	}
+	c.Body += strings.TrimRight(text, "\n")
+}
+
+func decodeTransfer(part mimePart) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(part.transferEncoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, part.body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(part.body)
+	default:
+		return part.body
+	}
+}
+
+func decodeText(part mimePart, charset string) (string, error) {
+	reader, err := charsetReader(charset, decodeTransfer(part))
+	if err != nil {
+		// unknown charset: show the raw bytes rather than nothing
+		reader = decodeTransfer(part)
+	}
+
+	text, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("cannot decode message body: %v", err)
+	}
+	return string(text), nil
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return input, nil
+	}
+
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset: %s", charset)
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
+
+var (
+	htmlInvisible = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlBreak     = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/h[1-6]|/li)[^>]*>`)
+	htmlTag       = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLines    = regexp.MustCompile(`\n\s*\n\s*\n+`)
+)
+
+// Crude conversion for messages that do not come with a text/plain part
+func htmlToText(text string) string {
+	text = htmlInvisible.ReplaceAllString(text, "")
+	text = strings.ReplaceAll(text, "\n", " ")
+	text = htmlBreak.ReplaceAllString(text, "\n")
+	text = htmlTag.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = blankLines.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
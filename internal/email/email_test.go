@@ -0,0 +1,240 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vrld/ansicht/internal/model"
+)
+
+// writes the message with CRLF line endings and reads it with ReadFile
+func readMessage(t *testing.T, message string) (*Content, error) {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "message")
+	message = strings.ReplaceAll(message, "\n", "\r\n")
+	if err := os.WriteFile(filename, []byte(message), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return ReadFile(model.Filename(filename))
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     string
+		body        string
+		attachments []string
+	}{
+		{
+			name: "plain text",
+			message: `Subject: plain
+
+Hello
+`,
+			body: "Hello",
+		},
+		{
+			name: "alternative prefers text/plain",
+			message: `Subject: alternative
+Content-Type: multipart/alternative; boundary="b"
+
+--b
+Content-Type: text/html
+
+<p>html</p>
+--b
+Content-Type: text/plain
+
+plain
+--b--
+`,
+			body: "plain",
+		},
+		{
+			name: "alternative without text/plain uses the last part",
+			message: `Subject: alternative
+Content-Type: multipart/alternative; boundary="b"
+
+--b
+Content-Type: text/enriched
+
+enriched
+--b
+Content-Type: text/html
+
+<p>first</p><p>second &amp; last</p>
+--b--
+`,
+			body: "first\nsecond & last",
+		},
+		{
+			name: "mixed with attachment",
+			message: `Subject: mixed
+Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+body
+--b
+Content-Type: application/pdf; name="=?utf-8?q?r=C3=A9sum=C3=A9.pdf?="
+Content-Disposition: attachment
+Content-Transfer-Encoding: base64
+
+AAECAw==
+--b--
+`,
+			body:        "body",
+			attachments: []string{"résumé.pdf"},
+		},
+		{
+			name: "latin-1 quoted-printable",
+			message: `Subject: charset
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+Gr=FC=DFe aus K=F6ln
+`,
+			body: "Grüße aus Köln",
+		},
+		{
+			name: "windows-1252 base64",
+			message: `Subject: charset
+Content-Type: text/plain; charset=windows-1252
+Content-Transfer-Encoding: base64
+
+gFN0cmHfZQ==
+`,
+			body: "€Straße",
+		},
+		{
+			name: "unknown charset shows raw bytes",
+			message: `Subject: charset
+Content-Type: text/plain; charset=x-unknown
+
+raw
+`,
+			body: "raw",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := readMessage(t, test.message)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if content.Body != test.body {
+				t.Errorf("body = %q, want %q", content.Body, test.body)
+			}
+
+			var attachments []string
+			for _, attachment := range content.Attachments {
+				attachments = append(attachments, attachment.Filename)
+			}
+			if strings.Join(attachments, ",") != strings.Join(test.attachments, ",") {
+				t.Errorf("attachments = %q, want %q", attachments, test.attachments)
+			}
+		})
+	}
+}
+
+func TestReadFileMalformed(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     string
+		wantErr     bool
+		body        string
+		attachments []string
+	}{
+		{
+			name:    "multipart without boundary",
+			message: "Content-Type: multipart/mixed\n\n--b\n\nbody\n--b--\n",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated multipart",
+			message: "Content-Type: multipart/mixed; boundary=b\n\n--b\nContent-Type: text/plain\n\nbody\n",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated alternative",
+			message: "Content-Type: multipart/alternative; boundary=b\n\n--b\nContent-Type: text/plain\n\nbody",
+			wantErr: true,
+		},
+		{
+			name:    "invalid base64",
+			message: "Content-Transfer-Encoding: base64\n\n!!! not base64 !!!\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid quoted-printable is shown as is",
+			message: "Content-Transfer-Encoding: quoted-printable\n\nbroken =ZZ escape\n",
+			body:    "broken =ZZ escape",
+		},
+		{
+			name:    "invalid content type is read as text",
+			message: "Content-Type: ;;;\n\nbody\n",
+			body:    "body",
+		},
+		{
+			name:    "nested part with invalid headers",
+			message: "Content-Type: multipart/mixed; boundary=b\n\n--b\nno colon in header\n\nbody\n--b--\n",
+			wantErr: true,
+		},
+		{
+			name:    "truncated attachment keeps the body read before",
+			message: "Content-Type: multipart/mixed; boundary=b\n\n--b\nContent-Type: text/plain\n\nbody\n--b\nContent-Type: application/pdf; name=a.pdf\nContent-Transfer-Encoding: base64\n\nAAEC",
+			wantErr: true,
+			body:    "body",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := readMessage(t, "Subject: malformed\n"+test.message)
+			if (err != nil) != test.wantErr {
+				t.Errorf("ReadFile() error = %v, want error: %v", err, test.wantErr)
+			}
+			// the content read so far is returned along with the error
+			if content == nil {
+				t.Fatal("ReadFile() returned no content")
+			}
+			if content.Body != test.body {
+				t.Errorf("body = %q, want %q", content.Body, test.body)
+			}
+
+			var attachments []string
+			for _, attachment := range content.Attachments {
+				attachments = append(attachments, attachment.Filename)
+			}
+			if strings.Join(attachments, ",") != strings.Join(test.attachments, ",") {
+				t.Errorf("attachments = %q, want %q", attachments, test.attachments)
+			}
+		})
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain subject", "plain subject"},
+		{"=?utf-8?q?gr=C3=BC=C3=9Fe?=", "grüße"},
+		{"=?UTF-8?B?w6TDtsO8?=", "äöü"},
+		{"=?iso-8859-1?q?K=F6ln?= ist =?iso-8859-1?q?sch=F6n?=", "Köln ist schön"},
+		{"=?utf-8?q?split?= =?utf-8?q?_words?=", "split words"},
+		{"=?unknown-charset?q?text?=", "=?unknown-charset?q?text?="},
+		{"=?utf-8?x?invalid?=", "=?utf-8?x?invalid?="},
+	}
+
+	for _, test := range tests {
+		if got := DecodeHeader(test.value); got != test.want {
+			t.Errorf("DecodeHeader(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -1,8 +1,57 @@
 package model
 
+type SortOrder int
+
+const (
+	SortNewestFirst SortOrder = iota
+	SortOldestFirst
+	SortMessageID
+	SortUnsorted
+)
+
+var sortOrderNames = [...]string{
+	SortNewestFirst: "newest-first",
+	SortOldestFirst: "oldest-first",
+	SortMessageID:   "message-id",
+	SortUnsorted:    "unsorted",
+}
+
+// the name as used by `notmuch search --sort=...`
+func (s SortOrder) String() string {
+	if s < 0 || int(s) >= len(sortOrderNames) {
+		return sortOrderNames[SortNewestFirst]
+	}
+	return sortOrderNames[s]
+}
+
+func ParseSortOrder(name string) (SortOrder, bool) {
+	for i, sortOrderName := range sortOrderNames {
+		if sortOrderName == name {
+			return SortOrder(i), true
+		}
+	}
+	return SortNewestFirst, false
+}
+
 type SearchQuery struct {
 	Query string
 	Name  string
+	Sort  SortOrder
+
+	// hide messages with tags in search.exclude_tags of the notmuch config,
+	// unless the query asks for these tags explicitly
+	OmitExcluded bool
+
+	// number of threads to skip and to return at most; Limit 0 means all
+	Offset int
+	Limit  int
+}
+
+// Reports whether both queries find the same threads in the same order,
+// regardless of their names.
+func (q SearchQuery) SameSearch(other SearchQuery) bool {
+	q.Name = other.Name
+	return q == other
 }
 
 type SearchResult struct {
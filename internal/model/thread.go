@@ -12,3 +12,9 @@ type Thread struct {
 	CountMatchedMessages int
 	Messages             []Message
 }
+
+// A message in the reply tree of a thread
+type ThreadNode struct {
+	Message Message
+	Depth   int
+}
@@ -0,0 +1,77 @@
+package remote
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Sends the request to the instance listening on socketPath. If socketPath
+// is empty, the most recently started instance is used.
+func Send(socketPath string, request Request) (Response, error) {
+	conn, err := dial(socketPath)
+	if err != nil {
+		return Response{}, err
+	}
+	defer conn.Close()
+
+	line, err := json.Marshal(request)
+	if err != nil {
+		return Response{}, err
+	}
+	if _, err := conn.Write(append(line, '\n')); err != nil {
+		return Response{}, fmt.Errorf("cannot send request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	answer, err := reader.ReadBytes('\n')
+	if err != nil {
+		return Response{}, fmt.Errorf("cannot read response: %w", err)
+	}
+
+	var response Response
+	if err := json.Unmarshal(answer, &response); err != nil {
+		return Response{}, fmt.Errorf("invalid response: %w", err)
+	}
+	return response, nil
+}
+
+func dial(socketPath string) (net.Conn, error) {
+	if socketPath != "" {
+		return net.Dial("unix", socketPath)
+	}
+
+	if err := CheckSocketDir(SocketDir()); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no running instance found in %s", SocketDir())
+	} else if err != nil {
+		return nil, fmt.Errorf("refusing socket directory: %w", err)
+	}
+
+	sockets, err := filepath.Glob(filepath.Join(SocketDir(), "*.sock"))
+	if err != nil {
+		return nil, err
+	}
+
+	// newest first; sockets of crashed instances refuse the connection
+	modified := make(map[string]time.Time, len(sockets))
+	for _, socket := range sockets {
+		if info, err := os.Stat(socket); err == nil {
+			modified[socket] = info.ModTime()
+		}
+	}
+	slices.SortFunc(sockets, func(a, b string) int {
+		return modified[b].Compare(modified[a])
+	})
+
+	for _, socket := range sockets {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, fmt.Errorf("no running instance found in %s", SocketDir())
+}
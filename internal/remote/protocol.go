@@ -0,0 +1,139 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/vrld/ansicht/internal/model"
+)
+
+// One request per line, e.g.
+//
+//	{"command": "query", "query": "tag:unread", "name": "unread"}
+//	{"command": "next"} / {"command": "prev"}
+//	{"command": "select", "tab": 2} / {"command": "select", "name": "unread"}
+//	{"command": "refresh"}
+//	{"command": "notify", "message": "new mail", "level": "info", "timeout": 5}
+//	{"command": "selected"} / {"command": "marked"}
+//	{"command": "eval", "code": "#ansicht.messages.all()"}
+//
+// Like in Lua, marked and all messages are only those of the search results
+// that were read so far.
+//
+// The optional id is copied to the response.
+type Request struct {
+	ID      int     `json:"id,omitempty"`
+	Command string  `json:"command"`
+	Query   string  `json:"query,omitempty"`
+	Name    string  `json:"name,omitempty"`
+	Tab     int     `json:"tab,omitempty"` // starts at 1, like in Lua
+	Message string  `json:"message,omitempty"`
+	Level   string  `json:"level,omitempty"`
+	Timeout float64 `json:"timeout,omitempty"`
+	Code    string  `json:"code,omitempty"`
+}
+
+// One response per request and line
+type Response struct {
+	ID       int       `json:"id,omitempty"`
+	OK       bool      `json:"ok"`
+	Error    string    `json:"error,omitempty"`
+	Messages []Message `json:"messages,omitempty"`
+	Results  []string  `json:"results,omitempty"`
+}
+
+type Message struct {
+	ID       string    `json:"id"`
+	ThreadID string    `json:"thread_id"`
+	Date     time.Time `json:"date"`
+	Filename string    `json:"filename"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Subject  string    `json:"subject"`
+	Tags     []string  `json:"tags"`
+}
+
+func messageFromModel(message *model.Message) Message {
+	return Message{
+		ID:       string(message.ID),
+		ThreadID: message.ThreadID,
+		Date:     message.Date,
+		Filename: string(message.Filename),
+		From:     message.From,
+		To:       message.To,
+		Subject:  message.Subject,
+		Tags:     message.Tags,
+	}
+}
+
+// Parses a request given as JSON object, or the shorthand `<command> [argument]`,
+// where the argument is the query, message or code, depending on the command.
+// The argument of select is the tab index if it is a number, else the name.
+func ParseCommand(command string) (Request, error) {
+	command = strings.TrimSpace(command)
+	if strings.HasPrefix(command, "{") {
+		var request Request
+		if err := json.Unmarshal([]byte(command), &request); err != nil {
+			return Request{}, fmt.Errorf("invalid request: %w", err)
+		}
+		return request, nil
+	}
+
+	name, argument, _ := strings.Cut(command, " ")
+	argument = strings.TrimSpace(argument)
+
+	request := Request{Command: name}
+	switch name {
+	case "query":
+		request.Query = argument
+	case "notify":
+		request.Message = argument
+	case "eval":
+		request.Code = argument
+	case "select":
+		if tab, err := strconv.Atoi(argument); err == nil {
+			request.Tab = tab
+		} else {
+			request.Name = argument
+		}
+	}
+	return request, nil
+}
+
+// $XDG_RUNTIME_DIR/ansicht, or a directory for the user in the temp directory
+func SocketDir() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "ansicht")
+	}
+	return filepath.Join(os.TempDir(), "ansicht-"+strconv.Itoa(os.Getuid()))
+}
+
+// Returns an error unless dir is a directory, not a symlink, that only the
+// current user can access. Otherwise another user could have created it in the
+// temp directory beforehand to plant sockets.
+func CheckSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not owned by the current user", dir)
+	}
+	if info.Mode().Perm() != 0700 {
+		return fmt.Errorf("%s must have mode 0700, has %#o", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+func SocketPath(pid int) string {
+	return filepath.Join(SocketDir(), fmt.Sprintf("%d.sock", pid))
+}
@@ -0,0 +1,251 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/vrld/ansicht/internal/model"
+	"github.com/vrld/ansicht/internal/runtime"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+type Controller interface {
+	runtime.ControllerAdapter
+
+	// Runs f where it may access the runtime and services, and waits until f
+	// returns or ctx is done. f may still run after an error was returned.
+	Exec(ctx context.Context, f func()) error
+}
+
+type Evaluator interface {
+	Eval(code string, chunkName string) ([]string, error)
+}
+
+// how long a command waits for the user interface, e.g., if it hangs or quit
+const execTimeout = 30 * time.Second
+
+// longest request line, e.g., of eval with a whole script
+const maxRequestSize = 16 * 1024 * 1024
+
+type Server struct {
+	path       string
+	listener   net.Listener
+	controller Controller
+	evaluator  Evaluator
+	ctx        context.Context // done when the server is closed
+	cancel     context.CancelFunc
+}
+
+// Listens on SocketPath(os.Getpid()) until Close is called
+func Listen(controller Controller, evaluator Evaluator) (*Server, error) {
+	if err := os.MkdirAll(SocketDir(), 0700); err != nil {
+		return nil, fmt.Errorf("cannot create socket directory: %w", err)
+	}
+	if err := CheckSocketDir(SocketDir()); err != nil {
+		return nil, fmt.Errorf("refusing socket directory: %w", err)
+	}
+
+	path := SocketPath(os.Getpid())
+	os.Remove(path) // left over from a process with the same pid
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("cannot restrict access to %s: %w", path, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &Server{
+		path:       path,
+		listener:   listener,
+		controller: controller,
+		evaluator:  evaluator,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	go server.serve()
+	return server, nil
+}
+
+func (s *Server) Path() string {
+	return s.path
+}
+
+func (s *Server) Close() error {
+	s.cancel()
+	err := s.listener.Close()
+	os.Remove(s.path)
+	return err
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			service.Logger().Error(fmt.Sprintf("remote: %v", err))
+			continue
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+func (s *Server) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRequestSize)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var request Request
+		var response Response
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			response = Response{Error: fmt.Sprintf("invalid request: %v", err)}
+		} else {
+			response = s.handle(request)
+		}
+
+		if err := encoder.Encode(response); err != nil {
+			service.Logger().Error(fmt.Sprintf("remote: %v", err))
+			return
+		}
+	}
+
+	// the rest of the request cannot be read, so the connection is closed
+	if err := scanner.Err(); err != nil {
+		message := fmt.Sprintf("cannot read request: %v", err)
+		if errors.Is(err, bufio.ErrTooLong) {
+			message = fmt.Sprintf("request is longer than %d bytes", maxRequestSize)
+		}
+		service.Logger().Error(fmt.Sprintf("remote: %s", message))
+		encoder.Encode(Response{Error: message})
+	}
+}
+
+func (s *Server) handle(request Request) Response {
+	response := Response{ID: request.ID, OK: true}
+
+	switch request.Command {
+	case "query":
+		if request.Query == "" {
+			return errorResponse(request, "missing query")
+		}
+		s.controller.QueryNew(model.SearchQuery{Query: request.Query, Name: request.Name})
+
+	case "next":
+		s.controller.QuerySelectNext()
+
+	case "prev":
+		s.controller.QuerySelectPrev()
+
+	case "refresh":
+		s.controller.Refresh(nil)
+
+	case "notify":
+		level := request.Level
+		if level == "" {
+			level = "info"
+		}
+		s.controller.Notify(request.Message, level, request.Timeout)
+
+	case "select":
+		if request.Tab == 0 && request.Name == "" {
+			return errorResponse(request, "missing tab index or name")
+		}
+		var selected bool
+		err := s.exec(func() {
+			index := request.Tab - 1
+			if request.Tab == 0 {
+				index = service.Queries().Find(request.Name)
+			}
+			if selected = service.Queries().Select(index); selected {
+				s.controller.QueryChanged()
+			}
+		})
+		if err != nil {
+			return errorResponse(request, err.Error())
+		}
+		if !selected {
+			return errorResponse(request, "no such tab")
+		}
+
+	case "selected":
+		var messages []Message
+		err := s.exec(func() {
+			if message := service.ActiveMessages().GetSelected(); message != nil {
+				messages = messagesFromModel([]*model.Message{message})
+			}
+		})
+		if err != nil {
+			return errorResponse(request, err.Error())
+		}
+		response.Messages = messages
+
+	case "marked":
+		var messages []Message
+		err := s.exec(func() {
+			messages = messagesFromModel(service.ActiveMessages().GetMarked())
+		})
+		if err != nil {
+			return errorResponse(request, err.Error())
+		}
+		response.Messages = messages
+
+	case "eval":
+		var results []string
+		var evalErr error
+		err := s.exec(func() {
+			results, evalErr = s.evaluator.Eval(request.Code, "remote")
+		})
+		if err == nil {
+			err = evalErr
+		}
+		if err != nil {
+			return errorResponse(request, err.Error())
+		}
+		response.Results = results
+
+	default:
+		return errorResponse(request, fmt.Sprintf("unknown command: %q", request.Command))
+	}
+
+	return response
+}
+
+// Runs f with the controller. The results of f must only be read if there is no
+// error, as f may run later, when the user interface catches up.
+func (s *Server) exec(f func()) error {
+	ctx, cancel := context.WithTimeout(s.ctx, execTimeout)
+	defer cancel()
+
+	if err := s.controller.Exec(ctx, f); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("no response from the user interface after %v", execTimeout)
+		}
+		return fmt.Errorf("cannot run command: %w", err)
+	}
+	return nil
+}
+
+func errorResponse(request Request, message string) Response {
+	return Response{ID: request.ID, Error: message}
+}
+
+func messagesFromModel(messages []*model.Message) []Message {
+	result := make([]Message, 0, len(messages))
+	for _, message := range messages {
+		result = append(result, messageFromModel(message))
+	}
+	return result
+}
@@ -0,0 +1,101 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/vrld/ansicht/internal/runtime"
+)
+
+// a controller whose user interface never runs the functions, e.g., because it quit
+type hangingController struct {
+	runtime.NullAdapter
+}
+
+func (c *hangingController) Exec(ctx context.Context, f func()) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHandleReturnsWhenServerIsClosed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &Server{controller: &hangingController{}, ctx: ctx, cancel: cancel}
+	cancel()
+
+	for _, command := range []string{"selected", "marked", "eval", "select"} {
+		response := server.handle(Request{ID: 1, Command: command, Code: "1", Tab: 1})
+		if response.OK || response.Error == "" {
+			t.Errorf("%s: response = %+v, want an error", command, response)
+		}
+	}
+}
+
+func TestParseCommandSelect(t *testing.T) {
+	tests := []struct {
+		command string
+		want    Request
+	}{
+		{"select 2", Request{Command: "select", Tab: 2}},
+		{"select unread", Request{Command: "select", Name: "unread"}},
+		{`{"command": "select", "name": "2"}`, Request{Command: "select", Name: "2"}},
+	}
+
+	for _, test := range tests {
+		got, err := ParseCommand(test.command)
+		if err != nil {
+			t.Errorf("ParseCommand(%q) error = %v", test.command, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseCommand(%q) = %+v, want %+v", test.command, got, test.want)
+		}
+	}
+}
+
+// sends the request line over a pipe to the server and returns the response
+func sendLine(t *testing.T, server *Server, line []byte) Response {
+	t.Helper()
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	go server.handleConnection(conn)
+
+	// the server may stop reading a request that is too long
+	go client.Write(append(line, '\n'))
+
+	answer, err := bufio.NewReader(client).ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("cannot read response: %v", err)
+	}
+	var response Response
+	if err := json.Unmarshal(answer, &response); err != nil {
+		t.Fatalf("invalid response %q: %v", answer, err)
+	}
+	return response
+}
+
+func TestHandleConnectionLongRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := &Server{controller: &hangingController{}, ctx: ctx, cancel: cancel}
+
+	request, err := json.Marshal(Request{Command: "notify", Message: strings.Repeat("x", 100*1024)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := sendLine(t, server, request); !response.OK {
+		t.Errorf("request of %d bytes: response = %+v, want ok", len(request), response)
+	}
+
+	request, err = json.Marshal(Request{Command: "notify", Message: strings.Repeat("x", maxRequestSize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := sendLine(t, server, request); response.OK || response.Error == "" {
+		t.Errorf("request of %d bytes: response = %+v, want an error", len(request), response)
+	}
+}
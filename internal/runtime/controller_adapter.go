@@ -1,50 +1,91 @@
 package runtime
 
-import "github.com/Shopify/go-lua"
+import (
+	"github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/model"
+)
 
 type ControllerAdapter interface {
 	Quit()
-	Refresh()
+	Refresh(messages []model.MessageID)
 	Status(message string)
 	Notify(message string, level string, timeout float64)
 	Input(prompt, placeholder string)
 	SpawnResult(result SpawnResult)
 	SetTheme(theme any)
 
-	QueryNew(query string)
+	QueryNew(query model.SearchQuery)
 	QuerySelectNext()
 	QuerySelectPrev()
+	QueryChanged()
 
 	MarksToggle()
 	MarksInvert()
 	MarksClear()
+
+	ThreadOpen(threadID string)
+	ThreadClose()
+
+	PreviewToggle()
+	PreviewResize(lines int, relative bool)
+	PreviewScroll(lines int)
 }
 
 type NullAdapter struct{}
 
 func (a *NullAdapter) Quit()                          {}
-func (a *NullAdapter) Refresh()                       {}
+func (a *NullAdapter) Refresh([]model.MessageID)      {}
 func (a *NullAdapter) Status(string)                  {}
 func (a *NullAdapter) Notify(string, string, float64) {}
 func (a *NullAdapter) Input(string, string)           {}
 func (a *NullAdapter) SpawnResult(SpawnResult)        {}
 func (a *NullAdapter) SetTheme(any)                   {}
 
-func (a *NullAdapter) QueryNew(string)  {}
-func (a *NullAdapter) QuerySelectNext() {}
-func (a *NullAdapter) QuerySelectPrev() {}
+func (a *NullAdapter) QueryNew(model.SearchQuery) {}
+func (a *NullAdapter) QuerySelectNext()           {}
+func (a *NullAdapter) QuerySelectPrev()           {}
+func (a *NullAdapter) QueryChanged()              {}
 
 func (a *NullAdapter) MarksToggle() {}
 func (a *NullAdapter) MarksInvert() {}
 func (a *NullAdapter) MarksClear()  {}
 
+func (a *NullAdapter) ThreadOpen(string) {}
+func (a *NullAdapter) ThreadClose()      {}
+
+func (a *NullAdapter) PreviewToggle()          {}
+func (a *NullAdapter) PreviewResize(int, bool) {}
+func (a *NullAdapter) PreviewScroll(int)       {}
+
+// ansicht.quit([exit_code])
 func (r *Runtime) luaQuit(L *lua.State) int {
+	r.exitCode = lua.OptInteger(L, 1, 0)
 	r.Controller.Quit()
 	return 0
 }
 
+// ansicht.refresh() reloads the current query
+// ansicht.refresh(message) and ansicht.refresh{messages} only re-read the given messages,
+// or all messages of the given threads
 func (r *Runtime) luaRefresh(L *lua.State) int {
-	r.Controller.Refresh()
+	if L.IsNoneOrNil(1) {
+		r.Controller.Refresh(nil)
+		return 0
+	}
+
+	ids, ok, err := getMessageIDs(L, 1)
+	if !ok {
+		lua.Errorf(L, "ansicht.refresh expects a message, a thread, or a table of those")
+		panic("unreachable")
+	}
+	if err != nil {
+		lua.Errorf(L, "%s", err.Error())
+		panic("unreachable")
+	}
+
+	if len(ids) > 0 {
+		r.Controller.Refresh(ids)
+	}
 	return 0
 }
 
@@ -54,9 +95,17 @@ func (r *Runtime) luaStatusSet(L *lua.State) int {
 	return 0
 }
 
+// ansicht.query.new(query[, name]) or ansicht.query.new(query, options) opens a new tab,
+// where options are like in ansicht.query.set()
 func (r *Runtime) luaQueryNew(L *lua.State) int {
 	if s, ok := r.luaState.ToString(1); ok {
-		r.Controller.QueryNew(s)
+		query := model.SearchQuery{Query: s}
+		if L.IsTable(2) {
+			queryOptionsArg(L, 2, &query)
+		} else {
+			query.Name = lua.OptString(L, 2, "")
+		}
+		r.Controller.QueryNew(query)
 	}
 	return 0
 }
@@ -76,6 +125,7 @@ func (r *Runtime) luaMarksToggle(L *lua.State) int {
 	return 0
 }
 
+// marks the unmarked messages that are read so far, see luaMessagesAll
 func (r *Runtime) luaMarksInvert(L *lua.State) int {
 	r.Controller.MarksInvert()
 	return 0
@@ -86,6 +136,53 @@ func (r *Runtime) luaMarksClear(L *lua.State) int {
 	return 0
 }
 
+// ansicht.thread.open(message) shows the thread of the message
+// ansicht.thread.open(thread) shows the thread
+func (r *Runtime) luaThreadOpen(L *lua.State) int {
+	threadID, ok := getMessageField(L, 1, "thread_id")
+	if thread, isThread := toThread(L, 1); isThread {
+		threadID, ok = thread.thread.ID, true
+	}
+	if !ok {
+		lua.Errorf(L, "ansicht.thread.open expects a message or a thread")
+		panic("unreachable")
+	}
+
+	r.Controller.ThreadOpen(threadID)
+	return 0
+}
+
+func (r *Runtime) luaThreadClose(L *lua.State) int {
+	r.Controller.ThreadClose()
+	return 0
+}
+
+func (r *Runtime) luaPreviewToggle(L *lua.State) int {
+	r.Controller.PreviewToggle()
+	return 0
+}
+
+// ansicht.preview.resize(lines) sets the height of the preview pane
+func (r *Runtime) luaPreviewResize(L *lua.State) int {
+	lines := lua.CheckInteger(L, 1)
+	r.Controller.PreviewResize(lines, false)
+	return 0
+}
+
+// ansicht.preview.grow(lines) makes the preview pane taller, or smaller if negative
+func (r *Runtime) luaPreviewGrow(L *lua.State) int {
+	lines := lua.CheckInteger(L, 1)
+	r.Controller.PreviewResize(lines, true)
+	return 0
+}
+
+// ansicht.preview.scroll(lines) scrolls down, or up if negative
+func (r *Runtime) luaPreviewScroll(L *lua.State) int {
+	lines := lua.CheckInteger(L, 1)
+	r.Controller.PreviewScroll(lines)
+	return 0
+}
+
 func (r *Runtime) luaNotify(L *lua.State) int {
 	if !L.IsTable(1) {
 		lua.Errorf(L, "ansicht.notify expects a table argument")
@@ -16,13 +16,61 @@ key["/"] = function()
     placeholder = "tag:unread",
     prompt = "notmuch search ",
     with_input = function(query)
-      ansicht.query.new(query)
+      -- like `notmuch search`, hide messages tagged with search.exclude_tags
+      ansicht.query.new(query, { omit_excluded = true })
       ansicht.status.set("")
     end,
+    -- tab completes history, search terms, tags and addresses; complete adds
+    -- more candidates that replace the word under the cursor
+    complete = function(word, input)
+      if word == "new" then
+        return { "tag:inbox and tag:unread" }
+      end
+    end,
   }
 end
+
+-- seed the search history; ansicht.history[prompt] behaves like a list
+if #ansicht.history["notmuch search "] == 0 then
+  ansicht.history["notmuch search "]:add("tag:unread")
+end
+
 key.left = ansicht.query.prev
 key.right = ansicht.query.next
+key["shift+left"] = function() ansicht.query.move(math.max(1, ansicht.query.current().index - 1)) end
+key["shift+right"] = function() ansicht.query.move(ansicht.query.current().index + 1) end
+key["ctrl+w"] = function() ansicht.query.close() end
+key.R = function()
+  ansicht.input {
+    placeholder = ansicht.query.current().name,
+    prompt = "rename tab ",
+    with_input = function(name) ansicht.query.rename(name) end,
+  }
+end
+-- change how the current tab searches
+key.o = function()
+  local sort = ansicht.query.current().sort == "newest-first" and "oldest-first" or "newest-first"
+  ansicht.query.set { sort = sort }
+end
+key.E = function()
+  ansicht.query.set { omit_excluded = not ansicht.query.current().omit_excluded }
+end
+
+-- save the tab to the notmuch config, so that `notmuch search query:NAME` works too
+key.S = function()
+  ansicht.input {
+    placeholder = ansicht.query.current().name,
+    prompt = "save query as ",
+    with_input = function(name)
+      local ok, err = ansicht.query.save(name)
+      if ok then
+        ansicht.notify { message = "saved query:" .. name, timeout = 3 }
+      else
+        ansicht.notify { message = err, level = "error" }
+      end
+    end,
+  }
+end
 
 -- mark messages for tagging
 key[" "] = ansicht.marks.toggle
@@ -35,13 +83,32 @@ key.enter = function()
     "/home/matthias/Projekte/übersicht.mail/einsicht/result/bin/einsicht",
     message.filename,
     next=function()
-      ansicht.tag(message, "-unread")
+      local _, err = ansicht.tag(message, "-unread")
+      if err then
+        ansicht.notify{ message = err, level = "error" }
+        return
+      end
       ansicht.status.set("Tagged -unread")
       ansicht.refresh { message }
     end
   }
 end
 
+-- show the conversation of the selected message as a reply tree
+key.T = function() ansicht.thread.open(ansicht.messages.selected()) end
+
+-- the thread view uses key.views.thread before falling back to the bindings above
+key.views.thread.esc = ansicht.thread.close
+key.views.thread.backspace = ansicht.thread.close
+key.views.thread.q = ansicht.thread.close
+
+-- preview pane below the list
+key.p = ansicht.preview.toggle
+key["+"] = function() ansicht.preview.grow(2) end
+key["-"] = function() ansicht.preview.grow(-2) end
+key.J = function() ansicht.preview.scroll(3) end
+key.K = function() ansicht.preview.scroll(-3) end
+
 -- wrapper function that returns a function that tags selected messages
 -- with the given tags and returns a refresh event
 local function tag_selected_messages(tags)
@@ -55,9 +122,18 @@ local function tag_selected_messages(tags)
   end
   -- notmuch.tag({msg1, msg2}, "+tag1", "-tag2", "+tag3")
   -- equivalent to notmuch tag +tag1 -tag2 +tag3 id:... id:...
-  ansicht.tag(messages_of_interest, table.unpack(tags))
+  -- returns the number of changed messages, or nil and an error message, and
+  -- a warning if the tags changed, but the maildir flags could not be updated
+  local count, err, warning = ansicht.tag(messages_of_interest, table.unpack(tags))
+  if not count then
+    ansicht.notify{ message = err, level = "error" }
+    return
+  end
+  if warning then
+    ansicht.notify{ message = warning, level = "warning" }
+  end
 
-  ansicht.status.set("Tagged " .. #messages_of_interest .. " messages: " .. table.concat(tags, " "))
+  ansicht.status.set("Tagged " .. count .. " messages: " .. table.concat(tags, " "))
   ansicht.refresh(messages_of_interest)
 end
 
@@ -65,6 +141,15 @@ key.d = function() tag_selected_messages { "+deleted", "-unread", "-inbox" } end
 key.a = function() tag_selected_messages { "+archive", "-inbox" } end
 key.u = function() tag_selected_messages { "+unread" } end
 
+-- threads tag all of their messages, e.g., to archive the whole conversation
+key.A = function()
+  local thread = ansicht.threads.selected()
+  if thread then
+    thread:tag("+archive", "-inbox")
+    ansicht.refresh(thread)
+  end
+end
+
 key.t = function ()
   ansicht.input {
     placeholder = "-unread +act",
@@ -82,6 +167,76 @@ key.t = function ()
   }
 end
 
+-- a table as binding starts a key sequence, e.g. "s f" flags the selected messages;
+-- the sequence is cancelled if no key is pressed within ansicht.key_timeout seconds
+ansicht.key_timeout = 1
+key.s = {
+  f = function() tag_selected_messages { "+flagged" } end,
+  u = function() tag_selected_messages { "-flagged" } end,
+}
+
+-- modes have their own key table in key.modes that takes precedence over the
+-- bindings above
+key.m = function() ansicht.mode.push("tagging") end
+key.modes.tagging = {
+  a = function() tag_selected_messages { "+archive", "-inbox" } end,
+  d = function() tag_selected_messages { "+deleted", "-unread", "-inbox" } end,
+  u = function() tag_selected_messages { "+unread" } end,
+  esc = ansicht.mode.pop,
+}
+
+-- react to events: ansicht.on(event, function(data) ... end) returns a handle
+-- that can be passed to ansicht.off(handle)
+ansicht.on("tagged", function(e)
+  ansicht.log.info("tagged " .. e.changed .. " messages: " .. table.concat(e.tags, " "))
+end)
+
+-- query tabs show counts in the background: {count} messages match the tab's
+-- query and its count query, {total} match the tab's query
+ansicht.tabs.format = "{name} ({count}/{total})"
+ansicht.tabs.count_query = "tag:unread"
+-- per tab: ansicht.tabs.count_queries = { INBOX = "tag:unread and not tag:list" }
+
+-- list items take ansicht.list.lines lines, two or more show the subject below
+-- the header. Columns are hidden when the list is narrower than their breakpoint.
+ansicht.list.lines = 1
+ansicht.list.breakpoints = { date = 40, recipient = 100, tags = 60 }
+key.L = function()
+  ansicht.list.lines = ansicht.list.lines == 1 and 2 or 1
+end
+
+-- list items can be rendered by Lua: the renderer returns a list of segments,
+-- each a string or { text, style, fg = ..., bg = ..., bold = true }, where style
+-- is one of date, sender, arrow, recipient, subject, tags and colors are theme
+-- names or color codes. ctx has width, lines, index, selected, marked, seen and
+-- theme. A newline in a segment starts the next line of the item. Returning nil
+-- or raising an error falls back to the built-in renderer for that item.
+-- ansicht.list.renderer = function(msg, ctx)
+--   return {
+--     { os.date("%Y-%m-%d  ", msg.date), "date" },
+--     { msg.from, "sender" },
+--     { "  " .. msg.subject, bold = not ctx.seen },
+--   }
+-- end
+
+-- the database is checked for changes every watch_interval seconds (0 disables),
+-- new_mail fires when the current query has new matches after a change
+ansicht.watch_interval = 5
+ansicht.on("new_mail", function(e)
+  ansicht.notify { message = e.count .. " new message(s) in " .. e.query, timeout = 5 }
+end)
+
+-- ansicht.search(query[, options]) and ansicht.count(query[, options]) ask the
+-- database directly without changing the list, e.g., to count the messages of a sender
+key.c = function()
+  local message = ansicht.messages.selected()
+  local sender = message and message.from_addresses[1]
+  if sender then
+    local count = ansicht.count("from:" .. sender.address)
+    ansicht.status.set(sender.address .. " wrote " .. count .. " messages")
+  end
+end
+
 function Startup()
   ansicht.log.info("Hello from Lua")
   ansicht.status.set("ansicht")
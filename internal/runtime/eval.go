@@ -0,0 +1,43 @@
+package runtime
+
+import (
+	"fmt"
+
+	lua "github.com/Shopify/go-lua"
+)
+
+// Evaluates code like the Lua REPL: an expression returns its values,
+// statements are executed. Returns the results converted to strings.
+// Errors are returned, not shown in the UI.
+func (r *Runtime) Eval(code string, chunkName string) ([]string, error) {
+	L := r.luaState
+	top := L.Top()
+	defer L.SetTop(top)
+
+	if err := lua.LoadBuffer(L, "return "+code, "="+chunkName, "t"); err != nil {
+		L.Pop(1)
+		if err := lua.LoadBuffer(L, code, "="+chunkName, "t"); err != nil {
+			message, _ := L.ToString(-1)
+			return nil, fmt.Errorf("%s", message)
+		}
+	}
+
+	L.PushGoFunction(luaMessageHandler)
+	L.Insert(top + 1)
+	if err := L.ProtectedCall(0, lua.MultipleReturns, top+1); err != nil {
+		message, ok := L.ToString(-1)
+		if !ok {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("%s", message)
+	}
+
+	last := L.Top()
+	results := make([]string, 0, last-top-1)
+	for i := top + 2; i <= last; i++ {
+		value, _ := lua.ToStringMeta(L, i)
+		L.Pop(1)
+		results = append(results, value)
+	}
+	return results, nil
+}
@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"fmt"
+	"slices"
+
+	lua "github.com/Shopify/go-lua"
+)
+
+const (
+	EventQueryChanged     = "query_changed"
+	EventResultsLoaded    = "results_loaded"
+	EventSelectionChanged = "selection_changed"
+	EventMarksChanged     = "marks_changed"
+	EventTagged           = "tagged"
+	EventInputOpened      = "input_opened"
+	EventSpawnFinished    = "spawn_finished"
+	EventResize           = "resize"
+	EventQuit             = "quit"
+	EventNewMail          = "new_mail"
+)
+
+var knownEvents = []string{
+	EventQueryChanged,
+	EventResultsLoaded,
+	EventSelectionChanged,
+	EventMarksChanged,
+	EventTagged,
+	EventInputOpened,
+	EventSpawnFinished,
+	EventResize,
+	EventQuit,
+	EventNewMail,
+}
+
+func eventHandlerHandleString(id int) string {
+	return fmt.Sprintf("ansicht.event_handler_handle_%d", id)
+}
+
+// handle = ansicht.on(event, function(data) ... end)
+func (r *Runtime) luaOn(L *lua.State) int {
+	event := lua.CheckString(L, 1)
+	if !slices.Contains(knownEvents, event) {
+		lua.ArgumentError(L, 1, "unknown event: "+event)
+		panic("unreachable")
+	}
+	lua.CheckType(L, 2, lua.TypeFunction)
+
+	r.countEventHandlers++
+	handle := r.countEventHandlers
+
+	L.PushString(eventHandlerHandleString(handle))
+	L.PushValue(2)
+	L.SetTable(lua.RegistryIndex)
+
+	if r.eventHandlers == nil {
+		r.eventHandlers = make(map[string][]int)
+	}
+	r.eventHandlers[event] = append(r.eventHandlers[event], handle)
+
+	L.PushInteger(handle)
+	return 1
+}
+
+// removed = ansicht.off(handle)
+func (r *Runtime) luaOff(L *lua.State) int {
+	handle := lua.CheckInteger(L, 1)
+
+	for event, handles := range r.eventHandlers {
+		if i := slices.Index(handles, handle); i >= 0 {
+			r.eventHandlers[event] = slices.Delete(handles, i, i+1)
+			lSetFieldNil(L, lua.RegistryIndex, eventHandlerHandleString(handle))
+			L.PushBoolean(true)
+			return 1
+		}
+	}
+
+	L.PushBoolean(false)
+	return 1
+}
+
+// Calls all handlers registered for the event with a table built from data.
+// Handlers are called in the order they were registered.
+func (r *Runtime) Emit(event string, data map[string]any) {
+	handles := slices.Clone(r.eventHandlers[event])
+	if len(handles) == 0 {
+		return
+	}
+
+	top := r.luaState.Top()
+	defer r.luaState.SetTop(top)
+
+	for _, handle := range handles {
+		r.luaState.PushString(eventHandlerHandleString(handle))
+		r.luaState.Table(lua.RegistryIndex)
+		if !r.luaState.IsFunction(-1) {
+			r.luaState.Pop(1)
+			continue
+		}
+
+		lPushMap(r.luaState, data)
+		lSetFieldString(r.luaState, -1, "event", event)
+		r.protectedCall(1, 0)
+	}
+}
@@ -10,7 +10,12 @@ func inputCallbackHandleString(id int) string {
 	return fmt.Sprintf("ansicht.input_callback_handle_%d", id)
 }
 
+func inputCompleteHandleString(id int) string {
+	return fmt.Sprintf("ansicht.input_complete_handle_%d", id)
+}
+
 // event.input{ placeholder = 'string', with_input = function(input) return event end}
+// optional: complete = function(word, input) return {candidate, ...} end
 func (r *Runtime) luaInput(L *lua.State) int {
 	if L.Top() < 1 || !L.IsTable(1) {
 		lua.Errorf(L, "missing table argument")
@@ -25,6 +30,10 @@ func (r *Runtime) luaInput(L *lua.State) int {
 	lFieldFunctionOrNil(L, 1, "with_input")
 	L.SetTable(lua.RegistryIndex)
 
+	L.PushString(inputCompleteHandleString(r.countOpenInputs))
+	lFieldFunctionOrNil(L, 1, "complete")
+	L.SetTable(lua.RegistryIndex)
+
 	r.Controller.Input(prompt, placeholder)
 	return 0
 }
@@ -40,10 +49,48 @@ func (r *Runtime) HandleInput(input string) {
 
 	if r.luaState.TypeOf(-1) == lua.TypeFunction {
 		r.luaState.PushString(input)
-		r.luaState.Call(1, 0)
+		r.protectedCall(1, 0)
 
 		r.luaState.PushString(handle)
 		r.luaState.PushNil()
 		r.luaState.SetTable(lua.RegistryIndex)
 	}
+
+	lSetFieldNil(r.luaState, lua.RegistryIndex, inputCompleteHandleString(r.countOpenInputs))
+}
+
+// Asks the complete function of the open input for candidates that replace
+// word, the word under the cursor in input.
+func (r *Runtime) Complete(word, input string) []string {
+	if r.countOpenInputs <= 0 {
+		return nil
+	}
+
+	L := r.luaState
+	top := L.Top()
+	defer L.SetTop(top)
+
+	L.PushString(inputCompleteHandleString(r.countOpenInputs))
+	L.Table(lua.RegistryIndex)
+	if !L.IsFunction(-1) {
+		return nil
+	}
+
+	L.PushString(word)
+	L.PushString(input)
+	if err := r.protectedCall(2, 1); err != nil || !L.IsTable(-1) {
+		return nil
+	}
+
+	var candidates []string
+	for i := 1; ; i++ {
+		L.RawGetInt(-1, i)
+		candidate, ok := L.ToString(-1)
+		L.Pop(1)
+		if !ok {
+			break
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
 }
@@ -0,0 +1,186 @@
+package runtime
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	lua "github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// registry key of the table that continues the current key sequence
+const pendingKeysHandle = "ansicht.pending_keys"
+
+const defaultKeyTimeout = time.Second
+
+// fields of the key table that hold the key tables of modes and views
+const (
+	keyModesTable = "modes"
+	keyViewsTable = "views"
+)
+
+// Call key binding defined in config. If the binding exists, it must be a function
+// that expects no arguments:
+//
+//	key.q = ansicht.quit
+//	key.r = ansicht.refresh
+//	key['d'] = function() ansicht.tag(ansicht.messages.selected(), "+deleted") end
+//
+// A table starts a key sequence that continues with the bindings in the table,
+// unless no key is pressed within ansicht.key_timeout seconds:
+//
+//	key.g = { g = function() ... end }
+//
+// The active mode (see ansicht.mode.push) and views other than the message
+// list first look up the binding in their own table and fall back to the
+// global bindings. These tables live in key.modes and key.views, so that
+// their names cannot clash with key names:
+//
+//	key.modes.tagging = { esc = ansicht.mode.pop }
+//	key.views.thread.esc = ansicht.thread.close
+func (r *Runtime) OnKey(keycode string) bool {
+	// leave stack in clean state on early exit
+	top := r.luaState.Top()
+	defer r.luaState.SetTop(top)
+
+	if len(r.pendingKeys) > 0 {
+		r.luaState.PushString(pendingKeysHandle)
+		r.luaState.Table(lua.RegistryIndex)
+		r.luaState.Field(-1, keycode)
+		if r.luaState.IsNil(-1) {
+			// unknown sequence: drop it along with the key
+			r.ResetPendingKeys()
+			return true
+		}
+		return r.callKeyBinding(keycode)
+	}
+
+	r.luaState.Global("key")
+	if !r.luaState.IsTable(-1) {
+		r.reportError(fmt.Errorf("Table `key` not found. Check your config."))
+		return false
+	}
+
+	type scope struct{ table, name string }
+	var scopes []scope
+	if mode := r.Mode(); mode != "" {
+		scopes = append(scopes, scope{keyModesTable, mode})
+	}
+	if view := service.View().Get(); view != service.ViewList {
+		scopes = append(scopes, scope{keyViewsTable, view})
+	}
+
+	for _, s := range scopes {
+		r.luaState.Field(-1, s.table)
+		if r.luaState.IsTable(-1) {
+			r.luaState.Field(-1, s.name)
+			if r.luaState.IsTable(-1) {
+				r.luaState.Field(-1, keycode)
+				if !r.luaState.IsNil(-1) {
+					return r.callKeyBinding(keycode)
+				}
+				r.luaState.Pop(1)
+			}
+			r.luaState.Pop(1)
+		}
+		r.luaState.Pop(1)
+	}
+
+	r.luaState.Field(-1, keycode)
+	if r.luaState.IsNil(-1) {
+		return false
+	}
+
+	return r.callKeyBinding(keycode)
+}
+
+// calls the key binding on top of the stack, or continues the key sequence
+func (r *Runtime) callKeyBinding(keycode string) bool {
+	if r.luaState.IsTable(-1) {
+		r.pendingKeys = append(r.pendingKeys, keycode)
+		r.luaState.PushString(pendingKeysHandle)
+		r.luaState.PushValue(-2)
+		r.luaState.SetTable(lua.RegistryIndex)
+		return true
+	}
+
+	sequence := append(r.pendingKeys, keycode)
+	r.ResetPendingKeys()
+
+	if r.luaState.IsFunction(-1) {
+		r.protectedCall(0, 0)
+		return true
+	}
+
+	r.reportError(fmt.Errorf("key binding for '%s' must be nil, a function or a table.", strings.Join(sequence, " ")))
+	return true
+}
+
+// keys of the unfinished key sequence
+func (r *Runtime) PendingKeys() []string {
+	return slices.Clone(r.pendingKeys)
+}
+
+func (r *Runtime) ResetPendingKeys() {
+	r.pendingKeys = nil
+	lSetFieldNil(r.luaState, lua.RegistryIndex, pendingKeysHandle)
+}
+
+// time to wait for the next key of a sequence: ansicht.key_timeout in seconds
+func (r *Runtime) KeyTimeout() time.Duration {
+	top := r.luaState.Top()
+	defer r.luaState.SetTop(top)
+
+	r.luaState.Global("ansicht")
+	if !r.luaState.IsTable(-1) {
+		return defaultKeyTimeout
+	}
+
+	if seconds, ok := lFieldNumber(r.luaState, -1, "key_timeout"); ok && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return defaultKeyTimeout
+}
+
+// the active mode, or "" if none
+func (r *Runtime) Mode() string {
+	if len(r.modes) == 0 {
+		return ""
+	}
+	return r.modes[len(r.modes)-1]
+}
+
+// ansicht.mode.push(name) activates the key table key.modes[name]
+func (r *Runtime) luaModePush(L *lua.State) int {
+	mode := lua.CheckString(L, 1)
+	r.modes = append(r.modes, mode)
+	r.ResetPendingKeys()
+	return 0
+}
+
+// name = ansicht.mode.pop() returns to the previous mode
+func (r *Runtime) luaModePop(L *lua.State) int {
+	if len(r.modes) == 0 {
+		L.PushNil()
+		return 1
+	}
+
+	mode := r.modes[len(r.modes)-1]
+	r.modes = r.modes[:len(r.modes)-1]
+	r.ResetPendingKeys()
+
+	L.PushString(mode)
+	return 1
+}
+
+// name = ansicht.mode.current(), nil if no mode is active
+func (r *Runtime) luaModeCurrent(L *lua.State) int {
+	if mode := r.Mode(); mode != "" {
+		L.PushString(mode)
+	} else {
+		L.PushNil()
+	}
+	return 1
+}
@@ -0,0 +1,31 @@
+package runtime
+
+import "testing"
+
+func TestOnKeyModeNamedLikeKey(t *testing.T) {
+	runtime, err := runtimeFromString(`
+		pressed = ""
+		key.q = function() pressed = "quit" end
+		key.x = function() pressed = "global x" end
+		key.modes.q = { x = function() pressed = "mode x" end }
+		ansicht.mode.push("q")
+	`, "test.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct{ key, want string }{
+		{"x", "mode x"},
+		{"q", "quit"},
+	} {
+		if !runtime.OnKey(tc.key) {
+			t.Fatalf("key %q was not handled", tc.key)
+		}
+		runtime.luaState.Global("pressed")
+		pressed, _ := runtime.luaState.ToString(-1)
+		runtime.luaState.Pop(1)
+		if pressed != tc.want {
+			t.Errorf("key %q called %q, want %q", tc.key, pressed, tc.want)
+		}
+	}
+}
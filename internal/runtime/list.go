@@ -0,0 +1,209 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+
+	lua "github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/model"
+)
+
+// State of a list item that is passed to ansicht.list.renderer
+type ListItemContext struct {
+	Width    int
+	Index    int
+	Selected bool
+	Marked   bool
+	Seen     bool
+	Lines    int               // lines per list item, see ListLayout
+	Theme    map[string]string // theme colors by the names of ansicht.theme.set
+}
+
+// Part of a list item rendered by Lua. Style names a column style of the
+// built-in renderer, e.g., "sender" or "subject". Foreground and Background
+// are theme color names or colors and override the style.
+type ListSegment struct {
+	Text       string
+	Style      string
+	Foreground string
+	Background string
+	Bold       bool
+	Italic     bool
+	Underline  bool
+}
+
+// Layout of the built-in list item renderer
+type ListLayout struct {
+	Lines       int            // lines per list item; two or more put the subject on its own line
+	Breakpoints map[string]int // the date, recipient and tags columns are hidden if the list is narrower
+}
+
+// columns that ansicht.list.breakpoints may hide
+var listBreakpointColumns = []string{"date", "recipient", "tags"}
+
+var defaultListBreakpoints = map[string]int{
+	"date":      40,
+	"recipient": 100,
+	"tags":      60,
+}
+
+// The layout from ansicht.list.lines and ansicht.list.breakpoints. Breakpoints
+// that are not set keep their defaults, zero always shows the column.
+func (r *Runtime) ListLayout() ListLayout {
+	L := r.luaState
+	top := L.Top()
+	defer L.SetTop(top)
+
+	layout := ListLayout{Lines: 1, Breakpoints: make(map[string]int, len(defaultListBreakpoints))}
+	for column, width := range defaultListBreakpoints {
+		layout.Breakpoints[column] = width
+	}
+
+	if r.pushListField("lines") {
+		if lines, ok := L.ToInteger(-1); ok {
+			layout.Lines = max(1, lines)
+		}
+	}
+	L.SetTop(top)
+
+	if r.pushListField("breakpoints") && L.IsTable(-1) {
+		for _, column := range listBreakpointColumns {
+			if width, ok := lFieldNumber(L, -1, column); ok {
+				layout.Breakpoints[column] = int(width)
+			}
+		}
+	}
+	return layout
+}
+
+// Renders a list item with ansicht.list.renderer(message, ctx), which returns
+// a list of segments: strings or tables {text, style, fg=..., bg=..., bold=...}.
+// A newline in the text of a segment starts the next line of the item.
+// Returns false if no renderer is set, the renderer returned nil, or failed.
+// A failing renderer stays installed, as it may fail only on some messages:
+// these fall back to the built-in renderer, and each error is reported once.
+func (r *Runtime) RenderListItem(message *model.Message, ctx ListItemContext) ([]ListSegment, bool) {
+	L := r.luaState
+	top := L.Top()
+	defer L.SetTop(top)
+
+	if !r.pushListField("renderer") || !L.IsFunction(-1) {
+		return nil, false
+	}
+
+	pushMessage(L, message)
+	pushListItemContext(L, ctx)
+	if err := r.unreportedProtectedCall(2, 1); err != nil {
+		r.reportListRendererError(err)
+		return nil, false
+	}
+
+	if L.IsNil(-1) {
+		return nil, false
+	}
+
+	segments, err := toListSegments(L, -1)
+	if err != nil {
+		r.reportListRendererError(fmt.Errorf("ansicht.list.renderer: %w", err))
+		return nil, false
+	}
+	return segments, true
+}
+
+// The renderer runs for every visible item on every redraw, so each error is
+// reported only the first time. Errors are told apart by their first line.
+func (r *Runtime) reportListRendererError(err error) {
+	summary, _, _ := strings.Cut(err.Error(), "\n")
+	if r.listRendererErrors[summary] {
+		return
+	}
+	if r.listRendererErrors == nil {
+		r.listRendererErrors = make(map[string]bool)
+	}
+	r.listRendererErrors[summary] = true
+	r.reportError(err)
+}
+
+// pushes ansicht.list[key] and returns true if ansicht.list is a table
+func (r *Runtime) pushListField(key string) bool {
+	r.luaState.Global("ansicht")
+	if !r.luaState.IsTable(-1) {
+		return false
+	}
+	r.luaState.Field(-1, "list")
+	if !r.luaState.IsTable(-1) {
+		return false
+	}
+	r.luaState.Field(-1, key)
+	return true
+}
+
+func pushListItemContext(L *lua.State, ctx ListItemContext) {
+	L.CreateTable(0, 7)
+	lSetFieldInteger(L, -1, "width", ctx.Width)
+	lSetFieldInteger(L, -1, "index", ctx.Index+1)
+	lSetFieldBool(L, -1, "selected", ctx.Selected)
+	lSetFieldBool(L, -1, "marked", ctx.Marked)
+	lSetFieldBool(L, -1, "seen", ctx.Seen)
+	lSetFieldInteger(L, -1, "lines", ctx.Lines)
+
+	L.CreateTable(0, len(ctx.Theme))
+	for name, color := range ctx.Theme {
+		lSetFieldString(L, -1, name, color)
+	}
+	L.SetField(-2, "theme")
+}
+
+func toListSegments(L *lua.State, index int) ([]ListSegment, error) {
+	index = L.AbsIndex(index)
+	if !L.IsTable(index) {
+		return nil, fmt.Errorf("expected a list of segments, got %s", lua.TypeNameOf(L, index))
+	}
+
+	length := L.RawLength(index)
+	segments := make([]ListSegment, 0, length)
+	for i := 1; i <= length; i++ {
+		L.RawGetInt(index, i)
+		segment, err := toListSegment(L, -1)
+		L.Pop(1)
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %w", i, err)
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// a segment is a string, or a table {text, style, fg=..., bg=..., bold=..., italic=..., underline=...}
+func toListSegment(L *lua.State, index int) (ListSegment, error) {
+	if L.IsString(index) {
+		text, _ := L.ToString(index)
+		return ListSegment{Text: text}, nil
+	}
+	if !L.IsTable(index) {
+		return ListSegment{}, fmt.Errorf("expected a string or table, got %s", lua.TypeNameOf(L, index))
+	}
+
+	var segment ListSegment
+	var ok bool
+	if segment.Text, ok = lFieldString(L, index, "text"); !ok {
+		L.RawGetInt(index, 1)
+		segment.Text, ok = L.ToString(-1)
+		L.Pop(1)
+	}
+	if !ok {
+		return ListSegment{}, fmt.Errorf("missing text")
+	}
+
+	if segment.Style, ok = lFieldString(L, index, "style"); !ok {
+		L.RawGetInt(index, 2)
+		segment.Style, _ = L.ToString(-1)
+		L.Pop(1)
+	}
+	segment.Foreground, _ = lFieldString(L, index, "fg")
+	segment.Background, _ = lFieldString(L, index, "bg")
+	segment.Bold, _ = lFieldBool(L, index, "bold")
+	segment.Italic, _ = lFieldBool(L, index, "italic")
+	segment.Underline, _ = lFieldBool(L, index, "underline")
+	return segment, nil
+}
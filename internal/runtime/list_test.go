@@ -0,0 +1,52 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/vrld/ansicht/internal/model"
+)
+
+// records the notifications of the runtime
+type notifyRecorder struct {
+	NullAdapter
+	notifications []string
+}
+
+func (a *notifyRecorder) Notify(message string, level string, timeout float64) {
+	a.notifications = append(a.notifications, message)
+}
+
+func TestRenderListItemKeepsFailingRenderer(t *testing.T) {
+	runtime, err := runtimeFromString(`
+		ansicht.list.renderer = function(msg, ctx)
+			if msg.subject == "bad" then
+				error("cannot render")
+			end
+			return { msg.subject }
+		end
+	`, "test.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &notifyRecorder{}
+	runtime.Controller = recorder
+
+	for i, subject := range []string{"good", "bad", "good", "bad"} {
+		message := &model.Message{ID: model.MessageID(subject), Subject: subject}
+		segments, ok := runtime.RenderListItem(message, ListItemContext{Index: i, Lines: 1})
+
+		if subject == "bad" {
+			if ok {
+				t.Errorf("item %d: rendered a failing item: %v", i, segments)
+			}
+			continue
+		}
+		if !ok || len(segments) != 1 || segments[0].Text != subject {
+			t.Errorf("item %d = %v, %v, want the renderer's segments", i, segments, ok)
+		}
+	}
+
+	if len(recorder.notifications) != 1 {
+		t.Errorf("reported %d errors, want 1: %q", len(recorder.notifications), recorder.notifications)
+	}
+}
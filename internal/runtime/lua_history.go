@@ -0,0 +1,205 @@
+package runtime
+
+import (
+	lua "github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// ansicht.history[prompt] returns the history of a prompt:
+//
+//	#ansicht.history[prompt]               -- number of entries
+//	ansicht.history[prompt][i]             -- i-th entry, 1 is the oldest
+//	ansicht.history[prompt][i] = "foo"     -- replace entry, #+1 appends, nil removes
+//	ansicht.history[prompt]:add("foo")     -- append, moves existing duplicates to the end
+//	ansicht.history[prompt]:remove(i[, j]) -- remove entries i to j, negative i and j count from the end
+//	ansicht.history[prompt]:clear()
+//	ansicht.history[prompt] = nil          -- same as clear()
+//	ansicht.history[prompt] = {...}        -- replace all entries
+//
+// ipairs() and pairs() iterate over the entries.
+func pushHistoryTable(L *lua.State) {
+	L.NewTable()
+	lua.NewLibrary(L, []lua.RegistryFunction{
+		{Name: "__index", Function: luaHistoryIndex},
+		{Name: "__newindex", Function: luaHistoryNewIndex},
+	})
+	L.SetMetaTable(-2)
+}
+
+// ansicht.history[prompt]
+func luaHistoryIndex(L *lua.State) int {
+	pushPromptHistory(L, lua.CheckString(L, 2))
+	return 1
+}
+
+// ansicht.history[prompt] = nil | {entries}
+func luaHistoryNewIndex(L *lua.State) int {
+	prompt := lua.CheckString(L, 2)
+	if !L.IsNil(3) && !L.IsTable(3) {
+		lua.ArgumentError(L, 3, "expected table or nil")
+		panic("unreachable")
+	}
+
+	var entries []string
+	if L.IsTable(3) {
+		for i := 1; ; i++ {
+			L.RawGetInt(3, i)
+			entry, ok := L.ToString(-1)
+			L.Pop(1)
+			if !ok {
+				break
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	history := service.InputHistory()
+	history.Clear(prompt)
+	for _, entry := range entries {
+		history.Add(prompt, entry)
+	}
+	return 0
+}
+
+func pushPromptHistory(L *lua.State, prompt string) {
+	L.NewTable()
+
+	L.NewTable()
+	L.PushString(prompt)
+	lua.SetFunctions(L, []lua.RegistryFunction{
+		{Name: "__len", Function: luaPromptHistoryLen},
+		{Name: "__index", Function: luaPromptHistoryIndex},
+		{Name: "__newindex", Function: luaPromptHistoryNewIndex},
+		{Name: "__ipairs", Function: luaPromptHistoryPairs},
+		{Name: "__pairs", Function: luaPromptHistoryPairs},
+	}, 1)
+
+	// methods
+	L.NewTable()
+	L.PushString(prompt)
+	lua.SetFunctions(L, []lua.RegistryFunction{
+		{Name: "add", Function: luaPromptHistoryAdd},
+		{Name: "remove", Function: luaPromptHistoryRemove},
+		{Name: "clear", Function: luaPromptHistoryClear},
+	}, 1)
+	L.SetField(-2, "methods")
+
+	L.SetMetaTable(-2)
+}
+
+func upvaluePrompt(L *lua.State) string {
+	prompt, _ := L.ToString(lua.UpValueIndex(1))
+	return prompt
+}
+
+// #ansicht.history[prompt]
+func luaPromptHistoryLen(L *lua.State) int {
+	L.PushInteger(service.InputHistory().Count(upvaluePrompt(L)))
+	return 1
+}
+
+// ansicht.history[prompt][i] or ansicht.history[prompt]:method
+func luaPromptHistoryIndex(L *lua.State) int {
+	if L.TypeOf(2) == lua.TypeString {
+		L.MetaTable(1)
+		L.Field(-1, "methods")
+		L.PushValue(2)
+		L.RawGet(-2)
+		return 1
+	}
+
+	index := lua.CheckInteger(L, 2)
+	history := service.InputHistory()
+	prompt := upvaluePrompt(L)
+	if index < 1 || index > history.Count(prompt) {
+		L.PushNil()
+		return 1
+	}
+
+	L.PushString(history.Entry(prompt, index-1))
+	return 1
+}
+
+// ansicht.history[prompt][i] = entry
+func luaPromptHistoryNewIndex(L *lua.State) int {
+	index := lua.CheckInteger(L, 2)
+	history := service.InputHistory()
+	prompt := upvaluePrompt(L)
+	count := history.Count(prompt)
+
+	if L.IsNil(3) {
+		if index >= 1 && index <= count {
+			history.Remove(prompt, index-1)
+		}
+		return 0
+	}
+
+	entry := lua.CheckString(L, 3)
+	if index == count+1 {
+		history.Add(prompt, entry)
+		return 0
+	}
+
+	if err := history.Set(prompt, index-1, entry); err != nil {
+		lua.ArgumentError(L, 2, err.Error())
+		panic("unreachable")
+	}
+	return 0
+}
+
+// for i, entry in ipairs(ansicht.history[prompt])
+func luaPromptHistoryPairs(L *lua.State) int {
+	L.PushValue(lua.UpValueIndex(1))
+	L.PushGoClosure(luaPromptHistoryNext, 1)
+	L.PushValue(1)
+	L.PushInteger(0)
+	return 3
+}
+
+func luaPromptHistoryNext(L *lua.State) int {
+	index := lua.CheckInteger(L, 2) + 1
+	history := service.InputHistory()
+	prompt := upvaluePrompt(L)
+	if index > history.Count(prompt) {
+		return 0
+	}
+
+	L.PushInteger(index)
+	L.PushString(history.Entry(prompt, index-1))
+	return 2
+}
+
+// ansicht.history[prompt]:add(entry)
+func luaPromptHistoryAdd(L *lua.State) int {
+	service.InputHistory().Add(upvaluePrompt(L), lua.CheckString(L, 2))
+	return 0
+}
+
+// ansicht.history[prompt]:remove(i[, j])
+func luaPromptHistoryRemove(L *lua.State) int {
+	lower := lua.CheckInteger(L, 2)
+	upper := lua.OptInteger(L, 3, lower)
+
+	// Lua indices start at 1, negative indices count from the end
+	if lower > 0 {
+		lower--
+	}
+	if upper > 0 {
+		upper--
+	}
+
+	if err := service.InputHistory().RemoveSlice(upvaluePrompt(L), lower, upper); err != nil {
+		L.PushBoolean(false)
+		L.PushString(err.Error())
+		return 2
+	}
+
+	L.PushBoolean(true)
+	return 1
+}
+
+// ansicht.history[prompt]:clear()
+func luaPromptHistoryClear(L *lua.State) int {
+	service.InputHistory().Clear(upvaluePrompt(L))
+	return 0
+}
@@ -1,51 +1,232 @@
 package runtime
 
 import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+
 	lua "github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/db"
 	"github.com/vrld/ansicht/internal/model"
 	"github.com/vrld/ansicht/internal/service"
 )
 
-// put all messages on the stack
+// put all messages on the stack; only those read so far while results are
+// still streamed, see the results_loaded event
 func (r *Runtime) luaMessagesAll(L *lua.State) int {
-	pushMessagesTable(L, service.Messages().GetAll())
+	pushMessagesTable(L, service.ActiveMessages().GetAll())
 	return 1
 }
 
 // put selected/highligted message on the stack
 func (r *Runtime) luaMessagesSelected(L *lua.State) int {
-	pushMessage(L, service.Messages().GetSelected())
+	pushMessage(L, service.ActiveMessages().GetSelected())
 	return 1
 }
 
 // put marked messages on the stack
 func (r *Runtime) luaMessagesMarked(L *lua.State) int {
-	pushMessagesTable(L, service.Messages().GetMarked())
+	pushMessagesTable(L, service.ActiveMessages().GetMarked())
 	return 1
 }
 
-// pushes a single message on the stack:
-// { __type = "ansicht.Message", id = "...", thread_id = "...", filename = "..." }
+// Messages are userdata with the fields and methods
+//
+//	msg.id, msg.thread_id, msg.subject, msg.from, msg.to -- strings
+//	msg.date                   -- seconds since the epoch, see os.date()
+//	msg.tags                   -- { "inbox", "unread", ... }
+//	msg.flags                  -- { draft = false, flagged = false, passed = false, replied = false, seen = true, trashed = false }
+//	msg.filename               -- one of the files of the message
+//	msg.filenames              -- all files, more than one if the message is duplicated
+//	msg.from_addresses         -- { { name = "Jane Doe", address = "jane@example.com" }, ... }
+//	msg.to_addresses           -- same for the recipients
+//	msg:header(name)           -- any header, e.g., msg:header("List-Id"), read from the file
+//	msg:tag(tag1, tag2, ...)   -- same as ansicht.tag(msg, tag1, tag2, ...)
+//	msg:has_tag(tag)
+//	msg:thread()               -- the thread of the message, see lua_threads.go
+//
+// The fields show the message as it was when it was read from the database,
+// e.g., msg:tag() does not change msg.tags.
 const LUA_TYPE_ID_MESSAGE = "ansicht.Message"
 
+func (r *Runtime) registerMessageType(L *lua.State) {
+	lua.NewMetaTable(L, LUA_TYPE_ID_MESSAGE)
+	lua.SetFunctions(L, []lua.RegistryFunction{
+		{Name: "__index", Function: r.luaMessageIndex},
+		{Name: "__eq", Function: luaMessageEq},
+		{Name: "__tostring", Function: luaMessageToString},
+	}, 0)
+	L.Pop(1)
+}
+
 func pushMessage(L *lua.State, message *model.Message) int {
-	L.CreateTable(0, 4)
-	L.PushString(LUA_TYPE_ID_MESSAGE)
-	L.SetField(-2, "__type")
+	if message == nil {
+		L.PushNil()
+		return 1
+	}
+
+	// a copy, so that Lua does not see later changes to the list
+	copied := *message
+	L.PushUserData(&copied)
+	lua.SetMetaTableNamed(L, LUA_TYPE_ID_MESSAGE)
+	return 1
+}
 
-	L.PushString(string(message.ID))
-	L.SetField(-2, "id")
+// returns the message object at `index` on the stack
+func toMessage(L *lua.State, index int) (*model.Message, bool) {
+	message, ok := lua.TestUserData(L, index, LUA_TYPE_ID_MESSAGE).(*model.Message)
+	return message, ok
+}
+
+func checkMessage(L *lua.State, index int) *model.Message {
+	message, ok := toMessage(L, index)
+	if !ok {
+		lua.ArgumentError(L, index, "expected message")
+		panic("unreachable")
+	}
+	return message
+}
 
-	L.PushString(string(message.ThreadID))
-	L.SetField(-2, "thread_id")
+func (r *Runtime) luaMessageIndex(L *lua.State) int {
+	message := checkMessage(L, 1)
+	key, _ := L.ToString(2)
 
-	L.PushString(string(message.Filename))
-	L.SetField(-2, "filename")
+	switch key {
+	case "__type":
+		L.PushString(LUA_TYPE_ID_MESSAGE)
+	case "id":
+		L.PushString(string(message.ID))
+	case "thread_id":
+		L.PushString(message.ThreadID)
+	case "subject":
+		L.PushString(message.Subject)
+	case "from":
+		L.PushString(message.From)
+	case "to":
+		L.PushString(message.To)
+	case "date":
+		L.PushInteger(int(message.Date.Unix()))
+	case "tags":
+		lPushStringTable(L, message.Tags)
+	case "flags":
+		pushMessageFlags(L, message.Flags)
+	case "filename":
+		L.PushString(string(message.Filename))
+	case "filenames":
+		filenames, err := db.MessageFilenames(message.ID)
+		if err != nil || len(filenames) == 0 {
+			filenames = []model.Filename{message.Filename}
+		}
+		L.CreateTable(len(filenames), 0)
+		for i, filename := range filenames {
+			L.PushString(string(filename))
+			L.RawSetInt(-2, i+1)
+		}
+	case "from_addresses":
+		pushAddressList(L, message.From)
+	case "to_addresses":
+		pushAddressList(L, message.To)
+	case "header":
+		L.PushGoFunction(luaMessageHeader)
+	case "tag":
+		L.PushGoFunction(r.luaNotmuchTag)
+	case "has_tag":
+		L.PushGoFunction(luaMessageHasTag)
+	case "thread":
+		L.PushGoFunction(luaMessageThread)
+	default:
+		L.PushNil()
+	}
+	return 1
+}
 
+func luaMessageEq(L *lua.State) int {
+	a, okA := toMessage(L, 1)
+	b, okB := toMessage(L, 2)
+	L.PushBoolean(okA && okB && a.ID == b.ID)
 	return 1
 }
 
+func luaMessageToString(L *lua.State) int {
+	message := checkMessage(L, 1)
+	L.PushString(fmt.Sprintf("%s <%s>", LUA_TYPE_ID_MESSAGE, message.ID))
+	return 1
+}
+
+// value = msg:header(name), or nil and an error message
+func luaMessageHeader(L *lua.State) int {
+	message := checkMessage(L, 1)
+	name := lua.CheckString(L, 2)
+
+	value, err := db.MessageHeader(message.ID, name)
+	if err != nil {
+		L.PushNil()
+		L.PushString(err.Error())
+		return 2
+	}
+	L.PushString(value)
+	return 1
+}
+
+// msg:has_tag(tag)
+func luaMessageHasTag(L *lua.State) int {
+	message := checkMessage(L, 1)
+	L.PushBoolean(slices.Contains(message.Tags, lua.CheckString(L, 2)))
+	return 1
+}
+
+// thread = msg:thread(), or nil and an error message
+func luaMessageThread(L *lua.State) int {
+	message := checkMessage(L, 1)
+
+	thread, nodes, err := db.FindThreadTree(message.ThreadID)
+	if err != nil {
+		L.PushNil()
+		L.PushString(err.Error())
+		return 2
+	}
+	pushThread(L, &thread, nodes)
+	return 1
+}
+
+func pushMessageFlags(L *lua.State, flags model.MessageFlags) {
+	L.CreateTable(0, 6)
+	lSetFieldBool(L, -1, "draft", flags.Draft)
+	lSetFieldBool(L, -1, "flagged", flags.Flagged)
+	lSetFieldBool(L, -1, "passed", flags.Passed)
+	lSetFieldBool(L, -1, "replied", flags.Replied)
+	lSetFieldBool(L, -1, "seen", flags.Seen)
+	lSetFieldBool(L, -1, "trashed", flags.Trashed)
+}
+
+// pushes { { name = "...", address = "..." }, ... }
+// Headers that cannot be parsed are returned as a single address.
+func pushAddressList(L *lua.State, header string) {
+	addresses, err := mail.ParseAddressList(header)
+	if err != nil {
+		addresses = nil
+		if header = strings.TrimSpace(header); header != "" {
+			addresses = []*mail.Address{{Address: header}}
+		}
+	}
+
+	L.CreateTable(len(addresses), 0)
+	for i, address := range addresses {
+		L.CreateTable(0, 2)
+		lSetFieldString(L, -1, "name", address.Name)
+		lSetFieldString(L, -1, "address", address.Address)
+		L.RawSetInt(-2, i+1)
+	}
+}
+
+// Messages used to be tables { __type = "ansicht.Message", id = "...", thread_id = "...", filename = "..." }.
+// These are still accepted where a message is expected.
 func isMessage(L *lua.State, index int) bool {
+	if _, ok := toMessage(L, index); ok {
+		return true
+	}
+
 	if !L.IsTable(index) {
 		return false
 	}
@@ -63,12 +244,64 @@ func pushMessagesTable(L *lua.State, messages []*model.Message) {
 	}
 }
 
-// returns message[field] where message is the message table at `index` on the stack
+// returns message[field] where message is the message at `index` on the stack
 // converts objects to string according to Lua rules
 func getMessageField(L *lua.State, index int, field string) (string, bool) {
 	if !isMessage(L, index) {
 		return "", false
 	}
 
-	return lFieldString(L, index, field)
+	L.Field(index, field)
+	defer L.Pop(1)
+	return L.ToString(-1)
+}
+
+// returns the IDs of the message, thread, or table of messages and threads at
+// `index` on the stack. Threads contribute all of their messages.
+func getMessageIDs(L *lua.State, index int) ([]model.MessageID, bool, error) {
+	var ids []model.MessageID
+	var threadIDs []string
+	collect := func(index int) {
+		if thread, ok := toThread(L, index); ok {
+			threadIDs = append(threadIDs, thread.thread.ID)
+		} else if id, ok := getMessageField(L, index, "id"); ok {
+			ids = append(ids, model.MessageID(id))
+		}
+	}
+
+	if _, isThread := toThread(L, index); isThread || isMessage(L, index) {
+		collect(index)
+	} else if L.IsTable(index) {
+		count := L.RawLength(index)
+		for i := 1; i <= count; i++ {
+			L.RawGetInt(index, i)
+			collect(-1)
+			L.Pop(1)
+		}
+	} else {
+		return nil, false, nil
+	}
+
+	if len(threadIDs) == 0 {
+		return ids, true, nil
+	}
+
+	threadMessageIDs, err := db.ThreadMessageIDs(threadIDs)
+	if err != nil {
+		return nil, true, err
+	}
+	for _, id := range threadMessageIDs {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, true, nil
+}
+
+func messageIDStrings(ids []model.MessageID) []string {
+	strs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strs = append(strs, string(id))
+	}
+	return strs
 }
@@ -0,0 +1,237 @@
+package runtime
+
+import (
+	lua "github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/model"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// Tabs are addressed by their position, starting at 1, or by name.
+// Functions that change tabs return true on success, false if there is no such tab.
+
+// returns the 0-based index of the tab at `index` on the stack, or -1 if there is none
+func queryIndexArg(L *lua.State, index int) int {
+	switch L.TypeOf(index) {
+	case lua.TypeNumber:
+		i, _ := L.ToInteger(index)
+		return i - 1
+	case lua.TypeString:
+		name, _ := L.ToString(index)
+		return service.Queries().Find(name)
+	default:
+		lua.ArgumentError(L, index, "expected tab index or name")
+		panic("unreachable")
+	}
+}
+
+// pushes { name = "...", query = "...", index = i, sort = "newest-first", omit_excluded = false, limit = 0, offset = 0 }
+func pushQuery(L *lua.State, query model.SearchQuery, index int) {
+	L.CreateTable(0, 7)
+	lSetFieldString(L, -1, "name", query.Name)
+	lSetFieldString(L, -1, "query", query.Query)
+	lSetFieldInteger(L, -1, "index", index+1)
+	lSetFieldString(L, -1, "sort", query.Sort.String())
+	lSetFieldBool(L, -1, "omit_excluded", query.OmitExcluded)
+	lSetFieldInteger(L, -1, "limit", query.Limit)
+	lSetFieldInteger(L, -1, "offset", query.Offset)
+}
+
+// Reads the options table at `index` into query. Fields that are absent stay unchanged:
+//
+//	name          = "..."
+//	sort          = "newest-first" | "oldest-first" | "message-id" | "unsorted"
+//	omit_excluded = true  -- hide tags in search.exclude_tags of the notmuch config
+//	limit         = 100   -- show at most this many threads, 0 shows all
+//	offset        = 0     -- skip this many threads
+func queryOptionsArg(L *lua.State, index int, query *model.SearchQuery) {
+	lua.CheckType(L, index, lua.TypeTable)
+
+	if name, ok := lFieldString(L, index, "name"); ok {
+		query.Name = name
+	}
+
+	if sortName, ok := lFieldString(L, index, "sort"); ok {
+		sort, ok := model.ParseSortOrder(sortName)
+		if !ok {
+			lua.ArgumentError(L, index, "unknown sort order: "+sortName)
+			panic("unreachable")
+		}
+		query.Sort = sort
+	}
+
+	if omitExcluded, ok := lFieldBool(L, index, "omit_excluded"); ok {
+		query.OmitExcluded = omitExcluded
+	}
+
+	if limit, ok := lFieldNumber(L, index, "limit"); ok {
+		query.Limit = max(0, int(limit))
+	}
+
+	if offset, ok := lFieldNumber(L, index, "offset"); ok {
+		query.Offset = max(0, int(offset))
+	}
+}
+
+// ok = ansicht.query.close([tab])
+func (r *Runtime) luaQueryClose(L *lua.State) int {
+	index := service.Queries().SelectedIndex()
+	if !L.IsNoneOrNil(1) {
+		index = queryIndexArg(L, 1)
+	}
+
+	ok := service.Queries().Close(index)
+	if ok {
+		r.Controller.QueryChanged()
+	}
+	L.PushBoolean(ok)
+	return 1
+}
+
+// ok = ansicht.query.rename([tab, ]name)
+func (r *Runtime) luaQueryRename(L *lua.State) int {
+	index := service.Queries().SelectedIndex()
+	if L.Top() >= 2 {
+		index = queryIndexArg(L, 1)
+	}
+	name := lua.CheckString(L, L.Top())
+
+	ok := service.Queries().Rename(index, name)
+	if ok {
+		r.Controller.QueryChanged()
+	}
+	L.PushBoolean(ok)
+	return 1
+}
+
+// ok = ansicht.query.move([tab, ]position)
+func (r *Runtime) luaQueryMove(L *lua.State) int {
+	index := service.Queries().SelectedIndex()
+	if L.Top() >= 2 {
+		index = queryIndexArg(L, 1)
+	}
+	position := lua.CheckInteger(L, L.Top())
+
+	ok := service.Queries().Move(index, position-1)
+	if ok {
+		r.Controller.QueryChanged()
+	}
+	L.PushBoolean(ok)
+	return 1
+}
+
+// ok = ansicht.query.select(tab)
+func (r *Runtime) luaQuerySelect(L *lua.State) int {
+	ok := service.Queries().Select(queryIndexArg(L, 1))
+	if ok {
+		r.Controller.QueryChanged()
+	}
+	L.PushBoolean(ok)
+	return 1
+}
+
+// ok = ansicht.query.replace([tab, ]query) changes the query, but not the name of the tab
+func (r *Runtime) luaQueryReplace(L *lua.State) int {
+	index := service.Queries().SelectedIndex()
+	if L.Top() >= 2 {
+		index = queryIndexArg(L, 1)
+	}
+	query := lua.CheckString(L, L.Top())
+
+	ok := service.Queries().Replace(index, query)
+	if ok {
+		r.Controller.QueryChanged()
+	}
+	L.PushBoolean(ok)
+	return 1
+}
+
+// ok = ansicht.query.set([tab, ]options) changes name, sort order, excluded tags, limit or offset
+func (r *Runtime) luaQuerySet(L *lua.State) int {
+	index := service.Queries().SelectedIndex()
+	if L.Top() >= 2 {
+		index = queryIndexArg(L, 1)
+	}
+
+	queries := service.Queries().All()
+	if index < 0 || index >= len(queries) {
+		L.PushBoolean(false)
+		return 1
+	}
+
+	query := queries[index]
+	queryOptionsArg(L, L.Top(), &query)
+	service.Queries().Set(index, query)
+	r.Controller.QueryChanged()
+	L.PushBoolean(true)
+	return 1
+}
+
+// ansicht.query.list() returns all tabs: { {name = "...", query = "...", index = 1}, ... }
+func (r *Runtime) luaQueryList(L *lua.State) int {
+	queries := service.Queries().All()
+	L.CreateTable(len(queries), 0)
+	for i, query := range queries {
+		pushQuery(L, query, i)
+		L.RawSetInt(-2, i+1)
+	}
+	return 1
+}
+
+// ansicht.query.current() returns the selected tab like in list(), or nil
+func (r *Runtime) luaQueryCurrent(L *lua.State) int {
+	query, ok := service.Queries().Current()
+	if !ok {
+		L.PushNil()
+		return 1
+	}
+	pushQuery(L, query, service.Queries().SelectedIndex())
+	return 1
+}
+
+// ok, err = ansicht.query.save(name) stores the query of the current tab in the
+// notmuch config as query:NAME, and renames the tab
+func (r *Runtime) luaQuerySave(L *lua.State) int {
+	name := lua.CheckString(L, 1)
+
+	query, ok := service.Queries().Current()
+	if !ok {
+		L.PushNil()
+		L.PushString("no query selected")
+		return 2
+	}
+	if query.Query == "query:"+name {
+		L.PushNil()
+		L.PushString("query must not refer to itself")
+		return 2
+	}
+
+	if err := db.SaveQuery(name, query.Query); err != nil {
+		service.Logger().Error(err.Error())
+		L.PushNil()
+		L.PushString(err.Error())
+		return 2
+	}
+
+	service.Queries().Rename(service.Queries().SelectedIndex(), name)
+	r.Controller.QueryChanged()
+	L.PushBoolean(true)
+	return 1
+}
+
+// ok, err = ansicht.query.delete(name) removes query:NAME from the notmuch config.
+// Open tabs are not affected. Returns false if there was no such query.
+func (r *Runtime) luaQueryDelete(L *lua.State) int {
+	name := lua.CheckString(L, 1)
+
+	deleted, err := db.DeleteQuery(name)
+	if err != nil {
+		service.Logger().Error(err.Error())
+		L.PushNil()
+		L.PushString(err.Error())
+		return 2
+	}
+
+	L.PushBoolean(deleted)
+	return 1
+}
@@ -0,0 +1,114 @@
+package runtime
+
+import (
+	lua "github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/model"
+)
+
+// Searches and counts run right away and do not change the shown messages.
+// Options are like in ansicht.query.set(), and additionally
+//
+//	output = "threads" | "messages"
+//
+// like `notmuch search --output=...`. Both functions return nil and an error
+// message if the search fails.
+
+// threads = ansicht.search(query[, options])
+// messages = ansicht.search(query, { output = "messages" }) returns only the matching messages
+func (r *Runtime) luaSearch(L *lua.State) int {
+	query, output := searchOptionsArg(L, "threads")
+	query.Query = lua.CheckString(L, 1)
+
+	switch output {
+	case "threads":
+		result, err := db.FindThreads(&query)
+		if err != nil {
+			L.PushNil()
+			L.PushString(err.Error())
+			return 2
+		}
+
+		threads := make([]*model.Thread, 0, len(result.Threads))
+		for i := range result.Threads {
+			threads = append(threads, &result.Threads[i])
+		}
+		pushThreadsTable(L, threads)
+
+	case "messages":
+		result, err := db.FindMessages(&query)
+		if err != nil {
+			L.PushNil()
+			L.PushString(err.Error())
+			return 2
+		}
+
+		messages := make([]*model.Message, 0, len(result))
+		for i := range result {
+			messages = append(messages, &result[i])
+		}
+		pushMessagesTable(L, messages)
+	}
+	return 1
+}
+
+// count = ansicht.count(query[, options]) counts messages, or threads with { output = "threads" }
+// counts = ansicht.count({query1, query2, ...}[, options])
+func (r *Runtime) luaCount(L *lua.State) int {
+	var queryStrings []string
+	if L.IsTable(1) {
+		for i := 1; i <= L.RawLength(1); i++ {
+			L.RawGetInt(1, i)
+			queryStrings = append(queryStrings, lua.CheckString(L, -1))
+			L.Pop(1)
+		}
+	} else {
+		queryStrings = []string{lua.CheckString(L, 1)}
+	}
+
+	options, output := searchOptionsArg(L, "messages")
+	queries := make([]model.SearchQuery, 0, len(queryStrings))
+	for _, queryString := range queryStrings {
+		options.Query = queryString
+		queries = append(queries, options)
+	}
+
+	count := db.CountMessages
+	if output == "threads" {
+		count = db.CountThreads
+	}
+	counts, err := count(queries)
+	if err != nil {
+		L.PushNil()
+		L.PushString(err.Error())
+		return 2
+	}
+
+	if !L.IsTable(1) {
+		L.PushInteger(counts[0])
+		return 1
+	}
+
+	L.CreateTable(len(counts), 0)
+	for i, count := range counts {
+		L.PushInteger(count)
+		L.RawSetInt(-2, i+1)
+	}
+	return 1
+}
+
+// reads the options at 2
+func searchOptionsArg(L *lua.State, defaultOutput string) (model.SearchQuery, string) {
+	var query model.SearchQuery
+	output := defaultOutput
+	if !L.IsNoneOrNil(2) {
+		queryOptionsArg(L, 2, &query)
+		output = lFieldStringOrDefault(L, 2, "output", defaultOutput)
+	}
+
+	if output != "threads" && output != "messages" {
+		lua.ArgumentError(L, 2, `output must be "threads" or "messages"`)
+		panic("unreachable")
+	}
+	return query, output
+}
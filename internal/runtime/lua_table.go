@@ -1,6 +1,11 @@
 package runtime
 
-import "github.com/Shopify/go-lua"
+import (
+	"fmt"
+
+	"github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/model"
+)
 
 func lFieldFunctionOrNil(L *lua.State, index int, key string) {
 	L.Field(index, key)
@@ -23,7 +28,7 @@ func lSetFieldNil(L *lua.State, index int, key string) {
 func lSetFieldString(L *lua.State, index int, key string, value string) {
 	L.PushString(key)
 	L.PushString(value)
-	if index != lua.RegistryIndex {
+	if index == lua.RegistryIndex {
 		L.SetTable(lua.RegistryIndex)
 	} else {
 		L.SetTable(index - 2)
@@ -33,7 +38,7 @@ func lSetFieldString(L *lua.State, index int, key string, value string) {
 func lSetFieldInteger(L *lua.State, index int, key string, value int) {
 	L.PushString(key)
 	L.PushInteger(value)
-	if index != lua.RegistryIndex {
+	if index == lua.RegistryIndex {
 		L.SetTable(lua.RegistryIndex)
 	} else {
 		L.SetTable(index - 2)
@@ -43,7 +48,7 @@ func lSetFieldInteger(L *lua.State, index int, key string, value int) {
 func lSetFieldBool(L *lua.State, index int, key string, value bool) {
 	L.PushString(key)
 	L.PushBoolean(value)
-	if index != lua.RegistryIndex {
+	if index == lua.RegistryIndex {
 		L.SetTable(lua.RegistryIndex)
 	} else {
 		L.SetTable(index - 2)
@@ -58,6 +63,41 @@ func lPushStringTable(L *lua.State, slice []string) {
 	}
 }
 
+// pushes a table with the entries of data
+func lPushMap(L *lua.State, data map[string]any) {
+	L.CreateTable(0, len(data))
+	for key, value := range data {
+		lPushValue(L, value)
+		L.SetField(-2, key)
+	}
+}
+
+// pushes strings, numbers, booleans, messages and (lists of) those
+func lPushValue(L *lua.State, value any) {
+	switch value := value.(type) {
+	case nil:
+		L.PushNil()
+	case string:
+		L.PushString(value)
+	case int:
+		L.PushInteger(value)
+	case float64:
+		L.PushNumber(value)
+	case bool:
+		L.PushBoolean(value)
+	case []string:
+		lPushStringTable(L, value)
+	case *model.Message:
+		pushMessage(L, value)
+	case []*model.Message:
+		pushMessagesTable(L, value)
+	case map[string]any:
+		lPushMap(L, value)
+	default:
+		L.PushString(fmt.Sprintf("%v", value))
+	}
+}
+
 func lFieldString(L *lua.State, index int, key string) (string, bool) {
 	L.Field(index, key)
 	defer L.Pop(1)
@@ -89,3 +129,12 @@ func lFieldNumberOrDefault(L *lua.State, index int, key string, defaultValue flo
 	}
 	return defaultValue
 }
+
+func lFieldBool(L *lua.State, index int, key string) (bool, bool) {
+	L.Field(index, key)
+	defer L.Pop(1)
+	if L.IsNil(-1) {
+		return false, false
+	}
+	return L.ToBoolean(-1), true
+}
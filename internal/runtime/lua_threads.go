@@ -0,0 +1,167 @@
+package runtime
+
+import (
+	"fmt"
+	"slices"
+
+	lua "github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/model"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// Threads are userdata with the fields and methods
+//
+//	thread.id, thread.subject  -- strings
+//	thread.authors             -- { "Jane Doe", ... }, authors of matching messages first
+//	thread.tags                -- tags of all messages
+//	thread.newest_date         -- seconds since the epoch, see os.date()
+//	thread.oldest_date
+//	thread.matched             -- number of messages that match the query
+//	thread.messages            -- all messages in reply order
+//	thread:tag(tag1, tag2, ...) -- same as ansicht.tag(thread, tag1, tag2, ...)
+//	thread:has_tag(tag)
+const LUA_TYPE_ID_THREAD = "ansicht.Thread"
+
+type luaThread struct {
+	thread model.Thread
+	nodes  []model.ThreadNode // reply tree, read when thread.messages is first accessed
+}
+
+func (r *Runtime) registerThreadType(L *lua.State) {
+	lua.NewMetaTable(L, LUA_TYPE_ID_THREAD)
+	lua.SetFunctions(L, []lua.RegistryFunction{
+		{Name: "__index", Function: r.luaThreadIndex},
+		{Name: "__eq", Function: luaThreadEq},
+		{Name: "__tostring", Function: luaThreadToString},
+	}, 0)
+	L.Pop(1)
+}
+
+// pushes a thread object; nodes may be nil and are read when needed
+func pushThread(L *lua.State, thread *model.Thread, nodes []model.ThreadNode) int {
+	if thread == nil {
+		L.PushNil()
+		return 1
+	}
+
+	L.PushUserData(&luaThread{thread: *thread, nodes: nodes})
+	lua.SetMetaTableNamed(L, LUA_TYPE_ID_THREAD)
+	return 1
+}
+
+func pushThreadsTable(L *lua.State, threads []*model.Thread) {
+	L.CreateTable(len(threads), 0)
+	for i, thread := range threads {
+		pushThread(L, thread, nil)
+		L.RawSetInt(-2, i+1)
+	}
+}
+
+func toThread(L *lua.State, index int) (*luaThread, bool) {
+	thread, ok := lua.TestUserData(L, index, LUA_TYPE_ID_THREAD).(*luaThread)
+	return thread, ok
+}
+
+func checkThread(L *lua.State, index int) *luaThread {
+	thread, ok := toThread(L, index)
+	if !ok {
+		lua.ArgumentError(L, index, "expected thread")
+		panic("unreachable")
+	}
+	return thread
+}
+
+// ansicht.threads.all() returns the threads of the shown messages, which are
+// only those read so far while results are still streamed
+func (r *Runtime) luaThreadsAll(L *lua.State) int {
+	pushThreadsTable(L, service.ActiveMessages().GetThreads())
+	return 1
+}
+
+// ansicht.threads.selected() returns the thread of the selected message, or nil
+func (r *Runtime) luaThreadsSelected(L *lua.State) int {
+	pushThread(L, service.ActiveMessages().GetSelectedThread(), nil)
+	return 1
+}
+
+func (r *Runtime) luaThreadIndex(L *lua.State) int {
+	object := checkThread(L, 1)
+	thread := &object.thread
+	key, _ := L.ToString(2)
+
+	switch key {
+	case "__type":
+		L.PushString(LUA_TYPE_ID_THREAD)
+	case "id":
+		L.PushString(thread.ID)
+	case "subject":
+		L.PushString(thread.Subject)
+	case "authors":
+		lPushStringTable(L, thread.Authors)
+	case "tags":
+		lPushStringTable(L, thread.Tags)
+	case "newest_date":
+		L.PushInteger(int(thread.NewestDate.Unix()))
+	case "oldest_date":
+		L.PushInteger(int(thread.OldestDate.Unix()))
+	case "matched":
+		L.PushInteger(thread.CountMatchedMessages)
+	case "messages":
+		pushThreadMessages(L, object)
+	case "tag":
+		L.PushGoFunction(r.luaNotmuchTag)
+	case "has_tag":
+		L.PushGoFunction(luaThreadHasTag)
+	default:
+		L.PushNil()
+	}
+	return 1
+}
+
+// pushes the messages in reply order, or in the order of the search if
+// the thread cannot be read
+func pushThreadMessages(L *lua.State, object *luaThread) {
+	if object.nodes == nil {
+		if _, nodes, err := db.FindThreadTree(object.thread.ID); err == nil {
+			object.nodes = nodes
+		} else {
+			service.Logger().Warning(err.Error())
+		}
+	}
+
+	if object.nodes == nil {
+		messages := make([]*model.Message, 0, len(object.thread.Messages))
+		for i := range object.thread.Messages {
+			messages = append(messages, &object.thread.Messages[i])
+		}
+		pushMessagesTable(L, messages)
+		return
+	}
+
+	L.CreateTable(len(object.nodes), 0)
+	for i := range object.nodes {
+		pushMessage(L, &object.nodes[i].Message)
+		L.RawSetInt(-2, i+1)
+	}
+}
+
+func luaThreadEq(L *lua.State) int {
+	a, okA := toThread(L, 1)
+	b, okB := toThread(L, 2)
+	L.PushBoolean(okA && okB && a.thread.ID == b.thread.ID)
+	return 1
+}
+
+func luaThreadToString(L *lua.State) int {
+	object := checkThread(L, 1)
+	L.PushString(fmt.Sprintf("%s <%s>", LUA_TYPE_ID_THREAD, object.thread.ID))
+	return 1
+}
+
+// thread:has_tag(tag)
+func luaThreadHasTag(L *lua.State) int {
+	object := checkThread(L, 1)
+	L.PushBoolean(slices.Contains(object.thread.Tags, lua.CheckString(L, 2)))
+	return 1
+}
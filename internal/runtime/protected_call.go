@@ -0,0 +1,69 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+
+	lua "github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// message handler for protected calls: adds a traceback to the error message
+func luaMessageHandler(L *lua.State) int {
+	message, ok := L.ToString(1)
+	if !ok {
+		message = fmt.Sprintf("(error object is a %s value)", lua.TypeNameOf(L, 1))
+	}
+	lua.Traceback(L, L, message, 1)
+	return 1
+}
+
+// Calls the function below the nargs arguments on top of the stack like
+// lua_pcall. Errors are logged with traceback and shown as notification.
+// On error, nothing is left on the stack.
+func (r *Runtime) protectedCall(nargs, nresults int) error {
+	err := r.unreportedProtectedCall(nargs, nresults)
+	if err != nil {
+		r.reportError(err)
+	}
+	return err
+}
+
+// Like protectedCall, but returns the error with traceback instead of showing it
+func (r *Runtime) unreportedProtectedCall(nargs, nresults int) error {
+	L := r.luaState
+
+	// put message handler below the function
+	handlerIndex := L.Top() - nargs
+	L.PushGoFunction(luaMessageHandler)
+	L.Insert(handlerIndex)
+
+	err := L.ProtectedCall(nargs, nresults, handlerIndex)
+	if err != nil {
+		message := err.Error()
+
+		// Lua errors leave the message handler's result on the stack,
+		// Go panics only carry the error
+		if _, isLuaError := err.(lua.RuntimeError); isLuaError {
+			if traceback, ok := L.ToString(-1); ok {
+				message = traceback
+			}
+		}
+		L.Pop(1)
+		L.Remove(handlerIndex)
+
+		return fmt.Errorf("%s", message)
+	}
+
+	L.Remove(handlerIndex)
+	return nil
+}
+
+// logs the error and shows its first line in the status line
+func (r *Runtime) reportError(err error) {
+	message := err.Error()
+	service.Logger().Error(message)
+
+	summary, _, _ := strings.Cut(message, "\n")
+	r.Controller.Notify(summary, "error", 0)
+}
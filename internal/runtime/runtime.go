@@ -1,65 +1,112 @@
 package runtime
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	_ "embed"
 
 	lua "github.com/Shopify/go-lua"
+	"github.com/vrld/ansicht/internal/db"
 	"github.com/vrld/ansicht/internal/service"
 )
 
 type Runtime struct {
-	luaState        *lua.State
-	countOpenInputs int
-	Controller      ControllerAdapter
+	luaState           *lua.State
+	countOpenInputs    int
+	countEventHandlers int
+	eventHandlers      map[string][]int
+	modes              []string
+	pendingKeys        []string
+	pendingSpawns      int
+	startupErrors      []error
+	listRendererErrors map[string]bool // errors of ansicht.list.renderer that were reported
+	exitCode           int
+	Controller         ControllerAdapter
 }
 
 //go:embed default_config.lua
 var defaultConfig string
 
+// Loads the user config. If that fails, the error is shown on startup and the
+// default config is used instead.
 func LoadRuntime() (*Runtime, error) {
+	configPath, content, err := readUserConfig()
+	if err != nil {
+		// no user config
+		return runtimeFromString(defaultConfig, "default_config.lua")
+	}
+
+	runtime, err := runtimeFromString(content, configPath)
+	if err == nil {
+		return runtime, nil
+	}
+
+	service.Logger().Error(err.Error())
+	runtime, defaultErr := runtimeFromString(defaultConfig, "default_config.lua")
+	if defaultErr != nil {
+		return nil, defaultErr
+	}
+	runtime.startupErrors = append(runtime.startupErrors, err)
+	return runtime, nil
+}
+
+func readUserConfig() (path string, content string, err error) {
 	// Try XDG_CONFIG_HOME first
 	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
-		content, err := os.ReadFile(filepath.Join(xdgConfigHome, "ansicht", "init.lua"))
-		if err == nil {
-			return runtimeFromString(string(content))
+		path = filepath.Join(xdgConfigHome, "ansicht", "init.lua")
+		if bytes, err := os.ReadFile(path); err == nil {
+			return path, string(bytes), nil
 		}
 	}
 
-	if home, err := os.UserHomeDir(); err == nil {
-		// maybe XDG_CONFIG_HOME was not set?
-		content, err := os.ReadFile(filepath.Join(home, ".config", "ansicht", "init.lua"))
-		if err == nil {
-			return runtimeFromString(string(content))
-		}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
 	}
 
-	// no user config
-	return runtimeFromString(defaultConfig)
+	// maybe XDG_CONFIG_HOME was not set?
+	path = filepath.Join(home, ".config", "ansicht", "init.lua")
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	return path, string(bytes), nil
 }
 
-func runtimeFromString(luaCode string) (*Runtime, error) {
+func runtimeFromString(luaCode string, chunkName string) (*Runtime, error) {
 	L := lua.NewState()
 	lua.OpenLibraries(L)
 
 	runtime := &Runtime{luaState: L, Controller: &NullAdapter{}}
+	runtime.registerMessageType(L)
+	runtime.registerThreadType(L)
 
-	// Create key table
+	// Create key table with tables for modes and the thread view
 	L.NewTable()
+	L.NewTable()
+	L.SetField(-2, keyModesTable)
+	L.NewTable()
+	L.NewTable()
+	L.SetField(-2, service.ViewThread)
+	L.SetField(-2, keyViewsTable)
 	L.SetGlobal("key")
 
 	lua.NewLibrary(L, []lua.RegistryFunction{
 		{Name: "quit", Function: runtime.luaQuit},
 		{Name: "refresh", Function: runtime.luaRefresh},
 		{Name: "spawn", Function: runtime.luaSpawn},
-		{Name: "tag", Function: luaNotmuchTag},
+		{Name: "tag", Function: runtime.luaNotmuchTag},
+		{Name: "search", Function: runtime.luaSearch},
+		{Name: "count", Function: runtime.luaCount},
 		{Name: "input", Function: runtime.luaInput},
 		{Name: "notify", Function: runtime.luaNotify},
+		{Name: "on", Function: runtime.luaOn},
+		{Name: "off", Function: runtime.luaOff},
 	})
 
 	// status
@@ -83,11 +130,28 @@ func runtimeFromString(luaCode string) (*Runtime, error) {
 	})
 	L.SetField(-2, "messages")
 
+	// threads access
+	lua.NewLibrary(L, []lua.RegistryFunction{
+		{Name: "all", Function: runtime.luaThreadsAll},
+		{Name: "selected", Function: runtime.luaThreadsSelected},
+	})
+	L.SetField(-2, "threads")
+
 	// query subgroup
 	lua.NewLibrary(L, []lua.RegistryFunction{
 		{Name: "new", Function: runtime.luaQueryNew},
 		{Name: "next", Function: runtime.luaQuerySelectNext},
 		{Name: "prev", Function: runtime.luaQuerySelectPrev},
+		{Name: "close", Function: runtime.luaQueryClose},
+		{Name: "rename", Function: runtime.luaQueryRename},
+		{Name: "move", Function: runtime.luaQueryMove},
+		{Name: "select", Function: runtime.luaQuerySelect},
+		{Name: "replace", Function: runtime.luaQueryReplace},
+		{Name: "set", Function: runtime.luaQuerySet},
+		{Name: "list", Function: runtime.luaQueryList},
+		{Name: "current", Function: runtime.luaQueryCurrent},
+		{Name: "save", Function: runtime.luaQuerySave},
+		{Name: "delete", Function: runtime.luaQueryDelete},
 	})
 	L.SetField(-2, "query")
 
@@ -99,6 +163,42 @@ func runtimeFromString(luaCode string) (*Runtime, error) {
 	})
 	L.SetField(-2, "marks")
 
+	// thread view
+	lua.NewLibrary(L, []lua.RegistryFunction{
+		{Name: "open", Function: runtime.luaThreadOpen},
+		{Name: "close", Function: runtime.luaThreadClose},
+	})
+	L.SetField(-2, "thread")
+
+	// modal keymaps
+	lua.NewLibrary(L, []lua.RegistryFunction{
+		{Name: "push", Function: runtime.luaModePush},
+		{Name: "pop", Function: runtime.luaModePop},
+		{Name: "current", Function: runtime.luaModeCurrent},
+	})
+	L.SetField(-2, "mode")
+
+	// preview pane
+	lua.NewLibrary(L, []lua.RegistryFunction{
+		{Name: "toggle", Function: runtime.luaPreviewToggle},
+		{Name: "resize", Function: runtime.luaPreviewResize},
+		{Name: "grow", Function: runtime.luaPreviewGrow},
+		{Name: "scroll", Function: runtime.luaPreviewScroll},
+	})
+	L.SetField(-2, "preview")
+
+	// tab settings, see TabFormat and TabCountQuery
+	L.NewTable()
+	L.SetField(-2, "tabs")
+
+	// list settings, see RenderListItem
+	L.NewTable()
+	L.SetField(-2, "list")
+
+	// input history per prompt
+	pushHistoryTable(L)
+	L.SetField(-2, "history")
+
 	// log.<level>(message)  =>  real-log(LEVEL, message)
 	lua.NewLibrary(L, []lua.RegistryFunction{
 		{Name: "__index", Function: runtime.luaLogMetatableIndex},
@@ -109,101 +209,172 @@ func runtimeFromString(luaCode string) (*Runtime, error) {
 
 	L.SetGlobal("ansicht")
 
-	// load config
-	if err := lua.DoString(L, luaCode); err != nil {
-		return nil, fmt.Errorf("error executing Lua config: %w", err)
+	if err := runtime.runChunk(luaCode, chunkName); err != nil {
+		return nil, fmt.Errorf("%s Lua config: %w", err.action, err)
 	}
 
 	return runtime, nil
 }
 
-func (r *Runtime) OnStartup() {
-	top := r.luaState.Top()
-	defer r.luaState.SetTop(top)
+type chunkError struct {
+	action  string
+	message string
+}
 
-	r.luaState.Global("Startup")
-	if r.luaState.IsFunction(-1) {
-		r.luaState.Call(0, 0)
+func (e *chunkError) Error() string {
+	return e.message
+}
+
+// loads and runs the code, errors include a traceback
+func (r *Runtime) runChunk(luaCode string, chunkName string) *chunkError {
+	L := r.luaState
+	top := L.Top()
+	defer L.SetTop(top)
+
+	if err := lua.LoadBuffer(L, luaCode, "@"+chunkName, "t"); err != nil {
+		message, _ := L.ToString(-1)
+		return &chunkError{"error loading", message}
+	}
+	L.PushGoFunction(luaMessageHandler)
+	L.Insert(-2)
+	if err := L.ProtectedCall(0, 0, -2); err != nil {
+		message, ok := L.ToString(-1)
+		if !ok {
+			message = err.Error()
+		}
+		return &chunkError{"error executing", message}
 	}
+
+	return nil
 }
 
-// Call key binding defined in config. If the binding exists, it must be a function
-// that expects no arguments:
-//
-//	key.q = ansicht.quit
-//	key.r = ansicht.refresh
-//	key['d'] = function() ansicht.tag(ansicht.messages.selected(), "+deleted") end
-func (r *Runtime) OnKey(keycode string) bool {
-	// leave stack in clean state on early exit
+// Runs a script in the loaded runtime, e.g., in batch mode
+func (r *Runtime) RunScript(luaCode string, chunkName string) error {
+	if err := r.runChunk(luaCode, chunkName); err != nil {
+		return fmt.Errorf("%s %s: %w", err.action, chunkName, err)
+	}
+	return nil
+}
+
+const defaultWatchInterval = 5 * time.Second
+
+// How often to check the database for changes, from ansicht.watch_interval
+// in seconds. Zero disables the check.
+func (r *Runtime) WatchInterval() time.Duration {
 	top := r.luaState.Top()
 	defer r.luaState.SetTop(top)
 
-	r.luaState.Global("key")
+	r.luaState.Global("ansicht")
 	if !r.luaState.IsTable(-1) {
-		lua.Errorf(r.luaState, "Table `key` not found. Check your config.")
-		panic("unreachable")
+		return defaultWatchInterval
 	}
-	r.luaState.Field(-1, keycode)
 
-	if r.luaState.IsNil(-1) {
-		return false
+	if seconds, ok := lFieldNumber(r.luaState, -1, "watch_interval"); ok {
+		return time.Duration(max(0, seconds) * float64(time.Second))
 	}
+	return defaultWatchInterval
+}
 
-	if r.luaState.IsFunction(-1) {
-		r.luaState.Call(0, 0)
-		return true
+// errors of the user config that were replaced by the default config
+func (r *Runtime) StartupErrors() []error {
+	return r.startupErrors
+}
+
+// the exit code passed to ansicht.quit()
+func (r *Runtime) ExitCode() int {
+	return r.exitCode
+}
+
+// number of spawned commands whose results were not handled yet
+func (r *Runtime) PendingSpawns() int {
+	return r.pendingSpawns
+}
+
+func (r *Runtime) OnStartup() {
+	top := r.luaState.Top()
+	defer r.luaState.SetTop(top)
+
+	for _, err := range r.startupErrors {
+		r.reportError(err)
 	}
+	r.startupErrors = nil
 
-	lua.Errorf(r.luaState, "key['%s'] must be nil or a function.", keycode)
-	panic("unreachable")
+	r.luaState.Global("Startup")
+	if r.luaState.IsFunction(-1) {
+		r.protectedCall(0, 0)
+	}
 }
 
 // Tag one or more messages
 // notmuch.tag(message, tag1, tag2, ..., tag3)
 // notmuch.tag({messages}, tag1, tag2, ..., tag3)
 // equivalent to: `notmuch tag tag1 tag2 tag3 id:... id:... ...`
-func luaNotmuchTag(L *lua.State) int {
+// Threads tag all of their messages, also those that do not match the query:
+// notmuch.tag(thread, tag1, ...) is like `notmuch tag tag1 ... thread:...`
+// returns the number of changed messages, or nil and an error message if nothing
+// was changed. If the tags were changed, but the maildir flags could not be
+// synchronized, returns the number, nil and a warning.
+func (r *Runtime) luaNotmuchTag(L *lua.State) int {
 	argc := L.Top()
 	if argc < 1 {
 		lua.Errorf(L, "invalid arguments")
 		panic("unreachable")
 	}
 
-	var messageIds []string
-
-	if isMessage(L, 1) {
-		if id, ok := getMessageField(L, 1, "id"); ok {
-			messageIds = append(messageIds, "id:"+id)
-		}
-	} else if L.IsTable(1) {
-		count := L.RawLength(1)
-		for i := 1; i <= count; i++ {
-			L.RawGetInt(1, i)
-			if id, ok := getMessageField(L, -1, "id"); ok {
-				messageIds = append(messageIds, "id:"+id)
-			}
-			L.Pop(1)
-		}
-	} else {
-		lua.Errorf(L, "Neither a message nor a table of messages")
+	messageIds, ok, err := getMessageIDs(L, 1)
+	if !ok {
+		lua.Errorf(L, "Neither a message, a thread, nor a table of those")
 		panic("unreachable")
 	}
+	if err != nil {
+		service.Logger().Error(err.Error())
+		L.PushNil()
+		L.PushString(err.Error())
+		return 2
+	}
 
-	if len(messageIds) > 0 {
-		args := []string{"tag"}
-		for i := 2; i <= L.Top(); i++ {
-			if tag, ok := L.ToString(i); ok {
-				args = append(args, tag)
-			}
+	var args []string
+	for i := 2; i <= argc; i++ {
+		if tag, ok := L.ToString(i); ok {
+			args = append(args, tag)
 		}
+	}
 
-		args = append(args, messageIds...)
+	changes, err := db.ParseTagChanges(args)
+	if err != nil {
+		L.PushNil()
+		L.PushString(err.Error())
+		return 2
+	}
 
-		cmd := exec.Command("notmuch", args...)
-		cmd.Run()
+	changed, err := db.TagMessages(messageIds, changes)
+	var flagsErr *db.MaildirFlagsError
+	if err != nil && !errors.As(err, &flagsErr) {
+		service.Logger().Error(err.Error())
+		L.PushNil()
+		L.PushString(err.Error())
+		return 2
 	}
 
-	return 0
+	tags := make([]string, 0, len(changes))
+	for _, change := range changes {
+		tags = append(tags, change.String())
+	}
+	r.Emit(EventTagged, map[string]any{
+		"message_ids": messageIDStrings(messageIds),
+		"tags":        tags,
+		"changed":     changed,
+	})
+
+	L.PushInteger(changed)
+	if flagsErr != nil {
+		// the tags were changed nevertheless
+		service.Logger().Warning(flagsErr.Error())
+		L.PushNil()
+		L.PushString(flagsErr.Error())
+		return 3
+	}
+	return 1
 }
 
 // returns the current status message
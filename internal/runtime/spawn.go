@@ -20,31 +20,39 @@ type SpawnResult struct {
 }
 
 func (r *Runtime) HandleSpawnResult(res SpawnResult) {
+	r.pendingSpawns--
+
+	top := r.luaState.Top()
+	defer r.luaState.SetTop(top)
+
 	r.luaState.PushString(completeHandleKey(res.HandleID))
 	r.luaState.Table(lua.RegistryIndex)
 
 	if r.luaState.TypeOf(-1) == lua.TypeFunction {
 		// Push spawn result as arguments to callback
-		r.luaState.CreateTable(0, 4)
-
-		r.luaState.PushString("command")
-		lPushStringTable(r.luaState, res.Command)
-		r.luaState.SetTable(-3)
-
-		if !res.Timeout {
-			lSetFieldInteger(r.luaState, -1, "return_code", res.ReturnCode)
-		}
-		lSetFieldBool(r.luaState, -1, "timeout", res.Timeout)
-		lSetFieldString(r.luaState, -1, "stdout", res.Stdout)
-		lSetFieldString(r.luaState, -1, "stderr", res.Stderr)
+		lPushMap(r.luaState, res.EventData())
 
-		r.luaState.Call(1, 0)
+		r.protectedCall(1, 0)
 
 		// Clean up both callbacks using derived keys
 		lSetFieldNil(r.luaState, lua.RegistryIndex, completeHandleKey(res.HandleID))
 	}
 }
 
+// the spawn result as passed to callbacks
+func (res SpawnResult) EventData() map[string]any {
+	data := map[string]any{
+		"command": res.Command,
+		"timeout": res.Timeout,
+		"stdout":  res.Stdout,
+		"stderr":  res.Stderr,
+	}
+	if !res.Timeout {
+		data["return_code"] = res.ReturnCode
+	}
+	return data
+}
+
 func completeHandleKey(handleId int) string {
 	return fmt.Sprintf("ansicht.spawn_complete_callback_handle_%d", handleId)
 }
@@ -95,6 +103,7 @@ func (r *Runtime) luaSpawn(L *lua.State) int {
 	lFieldFunctionOrNil(L, 1, "next")
 	L.SetTable(lua.RegistryIndex)
 
+	r.pendingSpawns++
 	go r.spawnCommand(command, time.Duration(timeoutMilliseconds)*time.Millisecond, spawnHandleId)
 
 	return 0
@@ -0,0 +1,54 @@
+package runtime
+
+const defaultTabCountQuery = "tag:unread"
+
+// pushes ansicht.tabs[key] and returns true if ansicht.tabs is a table
+func (r *Runtime) pushTabsField(key string) bool {
+	r.luaState.Global("ansicht")
+	if !r.luaState.IsTable(-1) {
+		return false
+	}
+	r.luaState.Field(-1, "tabs")
+	if !r.luaState.IsTable(-1) {
+		return false
+	}
+	r.luaState.Field(-1, key)
+	return true
+}
+
+// The label of query tabs from ansicht.tabs.format, where {name} is replaced
+// by the name of the query, {count} by the number of messages that match the
+// count query, and {total} by the number of messages that match the query.
+// Returns "{name}" if no format is set.
+func (r *Runtime) TabFormat() string {
+	top := r.luaState.Top()
+	defer r.luaState.SetTop(top)
+
+	if r.pushTabsField("format") {
+		if format, ok := r.luaState.ToString(-1); ok {
+			return format
+		}
+	}
+	return "{name}"
+}
+
+// The query that selects the messages of a tab to count, e.g., "tag:unread".
+// ansicht.tabs.count_queries[name] overrides ansicht.tabs.count_query.
+func (r *Runtime) TabCountQuery(name string) string {
+	top := r.luaState.Top()
+	defer r.luaState.SetTop(top)
+
+	if r.pushTabsField("count_queries") && r.luaState.IsTable(-1) {
+		if query, ok := lFieldString(r.luaState, -1, name); ok {
+			return query
+		}
+	}
+	r.luaState.SetTop(top)
+
+	if r.pushTabsField("count_query") {
+		if query, ok := r.luaState.ToString(-1); ok {
+			return query
+		}
+	}
+	return defaultTabCountQuery
+}
@@ -1,8 +1,10 @@
 package service
 
-import "slices"
-
-import "fmt"
+import (
+	"fmt"
+	"os"
+	"slices"
+)
 
 type inputHistory struct {
 	histories map[string][]string
@@ -10,6 +12,13 @@ type inputHistory struct {
 	// TODO: move selectIndex and related functionality out of the service and into
 	//       its own type
 	selectedIndex map[string]int
+
+	// file the history is persisted to, empty if not persisted
+	path string
+
+	// the file as of the last read or write, to read only what other instances appended since
+	file       os.FileInfo
+	fileOffset int64
 }
 
 var inputHistoryInstance *inputHistory
@@ -67,6 +76,17 @@ func (h *inputHistory) Add(prompt, input string) {
 		return
 	}
 
+	h.add(prompt, input)
+
+	if h.path != "" {
+		if err := h.appendToFile(prompt, input); err != nil {
+			Logger().Error(err.Error())
+		}
+	}
+}
+
+// adds to the in-memory history only, dropping the oldest entries when full
+func (h *inputHistory) add(prompt, input string) {
 	history := h.histories[prompt]
 
 	// Remove existing entry if present
@@ -78,6 +98,9 @@ func (h *inputHistory) Add(prompt, input string) {
 	}
 
 	history = append(history, input)
+	if len(history) > inputHistoryMaxEntries {
+		history = slices.Delete(history, 0, len(history)-inputHistoryMaxEntries)
+	}
 	h.histories[prompt] = history
 }
 
@@ -92,6 +115,59 @@ func (h *inputHistory) Get(prompt string) string {
 	return history[currentIndex]
 }
 
+// Returns the entry at index, or "" if there is none
+func (h *inputHistory) Entry(prompt string, index int) string {
+	history := h.histories[prompt]
+	if index < 0 || index >= len(history) {
+		return ""
+	}
+	return history[index]
+}
+
+// Replaces the entry at index. Other entries equal to input are removed.
+func (h *inputHistory) Set(prompt string, index int, input string) error {
+	history := h.histories[prompt]
+	if index < 0 || index >= len(history) {
+		return fmt.Errorf("index %d out of bounds: (0, %d)", index, len(history)-1)
+	}
+	if input == "" {
+		return fmt.Errorf("empty input")
+	}
+
+	replaced := history[index]
+	history[index] = input
+	for i := len(history) - 1; i >= 0; i-- {
+		if i != index && history[i] == input {
+			history = slices.Delete(history, i, i+1)
+		}
+	}
+	h.histories[prompt] = history
+	h.Reset(prompt)
+	h.save(func() {
+		if replaced != input {
+			h.removeEntries(prompt, []string{replaced})
+		}
+	})
+	return nil
+}
+
+func (h *inputHistory) Clear(prompt string) {
+	delete(h.histories, prompt)
+	h.Reset(prompt)
+	h.save(func() {
+		delete(h.histories, prompt)
+		h.Reset(prompt)
+	})
+}
+
+// removes all entries equal to one of inputs, e.g., after they were read from the file again
+func (h *inputHistory) removeEntries(prompt string, inputs []string) {
+	h.histories[prompt] = slices.DeleteFunc(h.histories[prompt], func(entry string) bool {
+		return slices.Contains(inputs, entry)
+	})
+	h.selectedIndex[prompt] = min(h.selectedIndex[prompt], h.Count(prompt))
+}
+
 func (h *inputHistory) Remove(prompt string, index int) error {
 	return h.RemoveSlice(prompt, index, index)
 }
@@ -127,6 +203,7 @@ func (h *inputHistory) RemoveSlice(prompt string, lower, upper int) error {
 	currentIndex := h.selectedIndex[prompt]
 
 	// Remove the slice (inclusive)
+	removed := slices.Clone(history[lower : upper+1])
 	newHistory := slices.Delete(history, lower, upper+1)
 	h.histories[prompt] = newHistory
 
@@ -139,5 +216,8 @@ func (h *inputHistory) RemoveSlice(prompt string, lower, upper int) error {
 		h.selectedIndex[prompt] = len(newHistory)
 	}
 
+	h.save(func() {
+		h.removeEntries(prompt, removed)
+	})
 	return nil
 }
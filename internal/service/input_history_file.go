@@ -0,0 +1,221 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// entries kept per prompt
+const inputHistoryMaxEntries = 500
+
+type inputHistoryEntry struct {
+	Prompt string `json:"prompt"`
+	Input  string `json:"input"`
+}
+
+// $XDG_STATE_HOME/ansicht/history, with XDG_STATE_HOME defaulting to ~/.local/state
+func DefaultInputHistoryPath() (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to determine home directory: %v", err)
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "ansicht", "history"), nil
+}
+
+// Loads the history from the file and appends new inputs to it.
+// The file holds one JSON object per line and may be shared by several
+// running instances; a lock file serializes access.
+func (h *inputHistory) Persist(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	h.path = path
+	return h.withFileLock(func() error {
+		lineCount, err := h.sync()
+		if err != nil {
+			return err
+		}
+
+		// drop duplicates and old entries once the file has grown enough
+		if lineCount > 2*h.totalCount()+inputHistoryMaxEntries {
+			return h.rewrite()
+		}
+		return nil
+	})
+}
+
+func (h *inputHistory) totalCount() int {
+	count := 0
+	for _, history := range h.histories {
+		count += len(history)
+	}
+	return count
+}
+
+// runs f while holding an exclusive lock on <path>.lock
+func (h *inputHistory) withFileLock(f func() error) error {
+	lock, err := os.OpenFile(h.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history lock: %w", err)
+	}
+	defer lock.Close()
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock history: %w", err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	return f()
+}
+
+// Reads the entries that other instances appended since the last read or write,
+// or all entries if the file was replaced in the meantime, e.g., by the rewrite
+// of another instance. Returns the number of lines read. The lock must be held.
+func (h *inputHistory) sync() (int, error) {
+	file, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		h.file, h.fileOffset = nil, 0
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open history: %w", err)
+	}
+	if h.file == nil || !os.SameFile(info, h.file) || info.Size() < h.fileOffset {
+		h.fileOffset = 0
+	}
+	if _, err := file.Seek(h.fileOffset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	lineCount := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineCount++
+
+		var entry inputHistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			Logger().Warning(fmt.Sprintf("skipping malformed history line %d: %v", lineCount, err))
+			continue
+		}
+		h.add(entry.Prompt, entry.Input)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return lineCount, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	if lineCount > 0 {
+		for prompt := range h.histories {
+			h.Reset(prompt)
+		}
+	}
+
+	h.file, h.fileOffset = info, info.Size()
+	return lineCount, nil
+}
+
+// remembers the file after writing it, so that sync skips what was written
+func (h *inputHistory) rememberFile() error {
+	info, err := os.Stat(h.path)
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	h.file, h.fileOffset = info, info.Size()
+	return nil
+}
+
+// replaces the file with the deduplicated in-memory history
+func (h *inputHistory) rewrite() error {
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), ".history-*")
+	if err != nil {
+		return fmt.Errorf("failed to create history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for prompt, history := range h.histories {
+		for _, input := range history {
+			line, err := json.Marshal(inputHistoryEntry{Prompt: prompt, Input: input})
+			if err != nil {
+				tmp.Close()
+				return fmt.Errorf("failed to encode history: %w", err)
+			}
+			writer.Write(append(line, '\n'))
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return h.rememberFile()
+}
+
+// Writes the history after entries were changed or removed. Entries that other
+// instances appended in the meantime are kept, but remove is applied to them,
+// so that removed entries do not come back from the file.
+func (h *inputHistory) save(remove func()) {
+	if h.path == "" {
+		return
+	}
+
+	err := h.withFileLock(func() error {
+		if _, err := h.sync(); err != nil {
+			return err
+		}
+		remove()
+		return h.rewrite()
+	})
+	if err != nil {
+		Logger().Error(err.Error())
+	}
+}
+
+// appends a single entry to the file
+func (h *inputHistory) appendToFile(prompt, input string) error {
+	line, err := json.Marshal(inputHistoryEntry{Prompt: prompt, Input: input})
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+
+	return h.withFileLock(func() error {
+		// keep the entries of other instances, and skip only our own line on the next sync
+		if _, err := h.sync(); err != nil {
+			return err
+		}
+
+		file, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open history: %w", err)
+		}
+		defer file.Close()
+
+		if _, err := file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write history: %w", err)
+		}
+		return h.rememberFile()
+	})
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/vrld/ansicht/internal/model"
 )
@@ -14,8 +15,9 @@ type MessageIndex struct {
 type messages struct {
 	threads        []model.Thread
 	messageIndex   []MessageIndex
+	depths         []int
 	selectedIndex  int
-	markedMessages map[int]MessageIndex
+	markedMessages map[model.MessageID]bool
 }
 
 var messagesInstance *messages
@@ -27,11 +29,68 @@ func Messages() *messages {
 	return messagesInstance
 }
 
+var threadMessagesInstance *messages
+
+// messages of the thread shown in the thread view
+func ThreadMessages() *messages {
+	if threadMessagesInstance == nil {
+		threadMessagesInstance = &messages{}
+	}
+	return threadMessagesInstance
+}
+
+// messages of the view that is currently shown
+func ActiveMessages() *messages {
+	if View().Get() == ViewThread {
+		return ThreadMessages()
+	}
+	return Messages()
+}
+
+// Sets the messages of a new search result. Marks are cleared and the first
+// message is selected.
 func (m *messages) SetThreads(threads []model.Thread) {
 	m.ClearMarks()
-	m.threads = threads
+	m.selectedIndex = 0
+	m.setThreads(threads)
+}
+
+// Sets the messages of a search result for the same query. Marks of messages
+// that are still present are kept, and the selection stays on the same message,
+// or its nearest neighbour if the message is gone.
+// Returns the number of messages that were not in the list before.
+func (m *messages) ReloadThreads(threads []model.Thread) (added int) {
+	neighbours := m.idsAroundSelection()
+	m.setThreads(threads)
+	m.restoreSelection(neighbours)
+	m.pruneMarks()
+
+	known := make(map[model.MessageID]bool, len(neighbours))
+	for _, id := range neighbours {
+		known[id] = true
+	}
+	for _, message := range m.GetAll() {
+		if !known[message.ID] {
+			added++
+		}
+	}
+	return added
+}
+
+func (m *messages) setThreads(threads []model.Thread) {
+	m.threads = nil
+	m.depths = nil
 	m.messageIndex = make([]MessageIndex, 0, len(threads)*2)
-	for threadIdx, thread := range m.threads {
+	m.AppendThreads(threads)
+}
+
+// Adds the threads of the next chunk of a search result to the end of the list.
+// Marks and selection are kept.
+func (m *messages) AppendThreads(threads []model.Thread) {
+	for _, thread := range threads {
+		threadIdx := len(m.threads)
+		m.threads = append(m.threads, thread)
+
 		// newest messages first
 		messageCount := len(thread.Messages)
 		for msgIdx := range thread.Messages {
@@ -43,10 +102,177 @@ func (m *messages) SetThreads(threads []model.Thread) {
 	}
 }
 
+// Replaces the stored messages with the given updated versions.
+// Returns the rows of the updated messages.
+func (m *messages) UpdateMessages(updated []model.Message) []int {
+	var rows []int
+	for _, message := range updated {
+		row := m.Find(message.ID)
+		if row < 0 {
+			continue
+		}
+
+		idx := m.messageIndex[row]
+		m.threads[idx.ThreadIdx].Messages[idx.MessageIdx] = message
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Removes the messages from the list. Marks of the remaining messages are kept.
+// Returns the removed rows in descending order.
+func (m *messages) RemoveMessages(ids []model.MessageID) []int {
+	var rows []int
+	for _, id := range ids {
+		if row := m.Find(id); row >= 0 {
+			rows = append(rows, row)
+		}
+	}
+	slices.Sort(rows)
+	slices.Reverse(rows)
+
+	for _, removedRow := range rows {
+		delete(m.markedMessages, m.Get(removedRow).ID)
+		m.messageIndex = slices.Delete(m.messageIndex, removedRow, removedRow+1)
+		if removedRow < len(m.depths) {
+			m.depths = slices.Delete(m.depths, removedRow, removedRow+1)
+		}
+	}
+
+	if m.selectedIndex >= m.Count() {
+		m.selectedIndex = max(0, m.Count()-1)
+	}
+
+	return rows
+}
+
+// Returns the row of the message with the given ID, or -1 if not found.
+func (m *messages) Find(id model.MessageID) int {
+	for row, idx := range m.messageIndex {
+		if m.threads[idx.ThreadIdx].Messages[idx.MessageIdx].ID == id {
+			return row
+		}
+	}
+	return -1
+}
+
+// Sets the messages of a single thread in reply order. If the thread is
+// already shown, marks and selection are kept like in ReloadThreads.
+func (m *messages) SetThreadTree(thread model.Thread, nodes []model.ThreadNode) {
+	current, reload := m.Thread()
+	reload = reload && current.ID == thread.ID
+
+	var neighbours []model.MessageID
+	if reload {
+		neighbours = m.idsAroundSelection()
+	} else {
+		m.ClearMarks()
+		m.selectedIndex = 0
+	}
+
+	thread.Messages = make([]model.Message, 0, len(nodes))
+	m.messageIndex = make([]MessageIndex, 0, len(nodes))
+	m.depths = make([]int, 0, len(nodes))
+	for msgIdx, node := range nodes {
+		thread.Messages = append(thread.Messages, node.Message)
+		m.messageIndex = append(m.messageIndex, MessageIndex{0, msgIdx})
+		m.depths = append(m.depths, node.Depth)
+	}
+	m.threads = []model.Thread{thread}
+
+	if reload {
+		m.restoreSelection(neighbours)
+		m.pruneMarks()
+	}
+}
+
+// IDs of all messages, ordered by distance to the selected message.
+// Of two messages with the same distance, the one below comes first.
+func (m *messages) idsAroundSelection() []model.MessageID {
+	ids := make([]model.MessageID, 0, m.Count())
+	for distance := 0; distance < m.Count(); distance++ {
+		if message := m.Get(m.selectedIndex + distance); message != nil {
+			ids = append(ids, message.ID)
+		}
+		if message := m.Get(m.selectedIndex - distance); message != nil && distance > 0 {
+			ids = append(ids, message.ID)
+		}
+	}
+	return ids
+}
+
+// selects the first of the messages that is still present
+func (m *messages) restoreSelection(neighbours []model.MessageID) {
+	rows := make(map[model.MessageID]int, m.Count())
+	for row, message := range m.GetAll() {
+		rows[message.ID] = row
+	}
+
+	for _, id := range neighbours {
+		if row, ok := rows[id]; ok {
+			m.selectedIndex = row
+			return
+		}
+	}
+	m.selectedIndex = max(0, min(m.selectedIndex, m.Count()-1))
+}
+
+// removes marks of messages that are no longer present
+func (m *messages) pruneMarks() {
+	present := make(map[model.MessageID]bool, len(m.markedMessages))
+	for _, message := range m.GetAll() {
+		if m.markedMessages[message.ID] {
+			present[message.ID] = true
+		}
+	}
+	m.markedMessages = present
+}
+
+// Returns the threads of the messages in list order
+func (m *messages) GetThreads() []*model.Thread {
+	var threads []*model.Thread
+	seen := make(map[int]bool, len(m.threads))
+	for _, idx := range m.messageIndex {
+		if !seen[idx.ThreadIdx] {
+			seen[idx.ThreadIdx] = true
+			threads = append(threads, &m.threads[idx.ThreadIdx])
+		}
+	}
+	return threads
+}
+
+// Returns the thread of the selected message, or nil
+func (m *messages) GetSelectedThread() *model.Thread {
+	if m.selectedIndex < 0 || m.selectedIndex >= m.Count() {
+		return nil
+	}
+	return &m.threads[m.messageIndex[m.selectedIndex].ThreadIdx]
+}
+
+// Returns the thread if the messages were set with SetThreadTree
+func (m *messages) Thread() (model.Thread, bool) {
+	if m.depths == nil || len(m.threads) != 1 {
+		return model.Thread{}, false
+	}
+	return m.threads[0], true
+}
+
+// Returns the depth in the reply tree, or 0 if not showing a thread
+func (m *messages) Depth(i int) int {
+	if i < 0 || i >= len(m.depths) {
+		return 0
+	}
+	return m.depths[i]
+}
+
 func (m *messages) Count() int {
 	return len(m.messageIndex)
 }
 
+func (m *messages) ThreadCount() int {
+	return len(m.threads)
+}
+
 func (m *messages) Selected() int {
 	return m.selectedIndex
 }
@@ -60,52 +286,40 @@ func (m *messages) Select(i int) error {
 }
 
 func (m *messages) IsMarked(i int) bool {
-	if i < 0 || i >= m.Count() {
-		return false
-	}
-
-	_, exists := m.markedMessages[i]
-	return exists
+	message := m.Get(i)
+	return message != nil && m.markedMessages[message.ID]
 }
 
 func (m *messages) Mark(i int) {
-	if i < 0 || i >= m.Count() {
-		return
+	if message := m.Get(i); message != nil {
+		m.markedMessages[message.ID] = true
 	}
-
-	m.markedMessages[i] = m.messageIndex[i]
 }
 
 func (m *messages) Unmark(i int) {
-	if i < 0 || i >= m.Count() {
-		return
+	if message := m.Get(i); message != nil {
+		delete(m.markedMessages, message.ID)
 	}
-
-	delete(m.markedMessages, i)
 }
 
 func (m *messages) ToggleMark(i int) {
-	if i < 0 || i >= m.Count() {
-		return
-	}
-
 	if m.IsMarked(i) {
-		delete(m.markedMessages, i)
+		m.Unmark(i)
 	} else {
-		m.markedMessages[i] = m.messageIndex[i]
+		m.Mark(i)
 	}
 }
 
 func (m *messages) ClearMarks() {
-	m.markedMessages = make(map[int]MessageIndex)
+	m.markedMessages = make(map[model.MessageID]bool)
 }
 
 func (m *messages) InvertMarks() {
 	expectedSize := m.Count() - len(m.markedMessages)
-	newSelection := make(map[int]MessageIndex, expectedSize)
-	for row, index := range m.messageIndex {
-		if !m.IsMarked(row) {
-			newSelection[row] = index
+	newSelection := make(map[model.MessageID]bool, expectedSize)
+	for _, message := range m.GetAll() {
+		if !m.markedMessages[message.ID] {
+			newSelection[message.ID] = true
 		}
 	}
 	m.markedMessages = newSelection
@@ -133,10 +347,13 @@ func (m *messages) GetSelected() *model.Message {
 	return m.Get(m.selectedIndex)
 }
 
+// Returns the marked messages in list order
 func (m *messages) GetMarked() []*model.Message {
 	selected := make([]*model.Message, 0, len(m.markedMessages))
-	for _, idx := range m.markedMessages {
-		selected = append(selected, &m.threads[idx.ThreadIdx].Messages[idx.MessageIdx])
+	for _, message := range m.GetAll() {
+		if m.markedMessages[message.ID] {
+			selected = append(selected, message)
+		}
 	}
 
 	return selected
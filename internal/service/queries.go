@@ -1,6 +1,8 @@
 package service
 
 import (
+	"slices"
+
 	"github.com/vrld/ansicht/internal/db"
 	"github.com/vrld/ansicht/internal/model"
 )
@@ -19,10 +21,10 @@ func Queries() *queries {
 
 	savedQueries, err := db.GetSavedQueries()
 	if err != nil || len(savedQueries) == 0 {
-		Logger().Warning(err.Error())
-		savedQueries = []model.SearchQuery{
-			{Name: "INBOX", Query: "query:INBOX"},
+		if err != nil {
+			Logger().Warning(err.Error())
 		}
+		savedQueries = defaultQueries()
 	}
 
 	queriesInstance = &queries{
@@ -32,6 +34,13 @@ func Queries() *queries {
 	return queriesInstance
 }
 
+// shown if there are no saved queries, or when the last tab is closed
+func defaultQueries() []model.SearchQuery {
+	return []model.SearchQuery{
+		{Name: "INBOX", Query: "query:INBOX"},
+	}
+}
+
 func (q *queries) All() []model.SearchQuery {
 	return q.queries
 }
@@ -78,3 +87,78 @@ func (q *queries) Add(query model.SearchQuery) {
 func (q *queries) AddQuery(name string, query string) {
 	q.Add(model.SearchQuery{Name: name, Query: query})
 }
+
+// Returns the index of the first query with the name, or -1 if not found
+func (q *queries) Find(name string) int {
+	for i, query := range q.queries {
+		if query.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Removes the query. If it was selected, the next query is selected.
+// Closing the last query opens the default query.
+func (q *queries) Close(i int) (ok bool) {
+	if i < 0 || i >= len(q.queries) {
+		return false
+	}
+
+	q.queries = slices.Delete(q.queries, i, i+1)
+	if len(q.queries) == 0 {
+		q.queries = defaultQueries()
+	}
+
+	if q.selectedIndex > i || q.selectedIndex >= len(q.queries) {
+		q.selectedIndex--
+	}
+	q.selectedIndex = max(0, q.selectedIndex)
+	return true
+}
+
+func (q *queries) Rename(i int, name string) (ok bool) {
+	if i < 0 || i >= len(q.queries) {
+		return false
+	}
+	q.queries[i].Name = name
+	return true
+}
+
+// Replaces the search query, but keeps the name
+func (q *queries) Replace(i int, query string) (ok bool) {
+	if i < 0 || i >= len(q.queries) {
+		return false
+	}
+	q.queries[i].Query = query
+	return true
+}
+
+func (q *queries) Set(i int, query model.SearchQuery) (ok bool) {
+	if i < 0 || i >= len(q.queries) {
+		return false
+	}
+	q.queries[i] = query
+	return true
+}
+
+// Moves the query to another position. The selected query stays selected.
+func (q *queries) Move(from, to int) (ok bool) {
+	if from < 0 || from >= len(q.queries) || to < 0 || to >= len(q.queries) {
+		return false
+	}
+
+	selected := q.selectedIndex
+	query := q.queries[from]
+	q.queries = slices.Insert(slices.Delete(q.queries, from, from+1), to, query)
+
+	switch {
+	case selected == from:
+		q.selectedIndex = to
+	case from < selected && selected <= to:
+		q.selectedIndex--
+	case to <= selected && selected < from:
+		q.selectedIndex++
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package service
+
+import "sync"
+
+const (
+	ViewList   = "list"
+	ViewThread = "thread"
+)
+
+type view struct {
+	mu   sync.RWMutex
+	name string
+}
+
+var viewInstance *view
+
+func View() *view {
+	if viewInstance == nil {
+		viewInstance = &view{
+			name: ViewList,
+		}
+	}
+	return viewInstance
+}
+
+func (v *view) Set(name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.name = name
+}
+
+func (v *view) Get() string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.name
+}
@@ -0,0 +1,225 @@
+package ui
+
+import (
+	"net/mail"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// at most this many candidates are shown in the popup
+const completionPopupHeight = 6
+
+var searchTermPrefixes = []string{
+	"tag:", "is:", "from:", "to:", "subject:", "folder:", "path:", "date:", "id:", "thread:", "query:",
+}
+
+var dateCompletions = []string{
+	"date:today", "date:yesterday", "date:1week..", "date:1month..", "date:1year..",
+}
+
+// sent when the tags of the database were read for completion
+type CompletionTagsMsg struct {
+	Tags  []string
+	Error error
+}
+
+type completionCandidate struct {
+	Text   string
+	Start  int // rune offset in the input that Text replaces up to the cursor
+	Source string
+}
+
+// state of tab completion in the input line
+type completion struct {
+	input      []rune
+	cursor     int
+	candidates []completionCandidate
+	selected   int
+}
+
+func (c *completion) active() bool {
+	return len(c.candidates) > 0
+}
+
+func loadCompletionTags() tea.Msg {
+	tags, err := db.AllTags()
+	return CompletionTagsMsg{Tags: tags, Error: err}
+}
+
+// Completes the word under the cursor, or cycles through the candidates if
+// completion is already in progress.
+func (m *Model) complete(step int) {
+	if m.completion.active() {
+		count := len(m.completion.candidates)
+		m.completion.selected = ((m.completion.selected+step)%count + count) % count
+		m.applyCompletion()
+		return
+	}
+
+	input := []rune(m.input.Value())
+	cursor := min(m.input.Position(), len(input))
+	start := cursor
+	for start > 0 && !strings.ContainsRune(" (", input[start-1]) {
+		start--
+	}
+
+	word := string(input[start:cursor])
+	candidates := m.completionCandidates(string(input), word, start)
+	if len(candidates) == 0 {
+		return
+	}
+
+	m.completion = completion{input: input, cursor: cursor, candidates: candidates}
+	if step < 0 {
+		m.completion.selected = len(candidates) - 1
+	}
+	m.applyCompletion()
+}
+
+func (m *Model) resetCompletion() {
+	m.completion = completion{}
+}
+
+func (m *Model) applyCompletion() {
+	c := m.completion
+	candidate := c.candidates[c.selected]
+
+	value := string(c.input[:candidate.Start]) + candidate.Text
+	m.input.SetValue(value + string(c.input[c.cursor:]))
+	m.input.SetCursor(len([]rune(value)))
+}
+
+func (m *Model) completionCandidates(input, word string, start int) []completionCandidate {
+	var candidates []completionCandidate
+	type replacement struct {
+		text  string
+		start int
+	}
+	seen := make(map[replacement]bool)
+	add := func(text string, start int, source string) {
+		if seen[replacement{text, start}] {
+			return
+		}
+		seen[replacement{text, start}] = true
+		candidates = append(candidates, completionCandidate{Text: text, Start: start, Source: source})
+	}
+
+	for _, candidate := range m.runtime.Complete(word, input) {
+		add(candidate, start, "lua")
+	}
+
+	// most recent history entry that begins with the input
+	history := service.InputHistory()
+	prompt := m.input.Prompt
+	for i := history.Count(prompt) - 1; i >= 0 && input != ""; i-- {
+		if entry := history.Entry(prompt, i); entry != input && strings.HasPrefix(entry, input) {
+			add(entry, 0, "history")
+			break
+		}
+	}
+
+	// negation and tag operations: -tag:foo, +foo
+	sign := ""
+	if strings.HasPrefix(word, "-") || strings.HasPrefix(word, "+") {
+		sign, word = word[:1], word[1:]
+	}
+
+	term, value, hasPrefix := strings.Cut(word, ":")
+	switch {
+	case !hasPrefix:
+		if sign == "-" || sign == "+" {
+			for _, tag := range m.completionTags {
+				if strings.HasPrefix(tag, word) {
+					add(sign+tag, start, "tag")
+				}
+			}
+		}
+		for _, prefix := range searchTermPrefixes {
+			if strings.HasPrefix(prefix, word) {
+				add(sign+prefix, start, "prefix")
+			}
+		}
+
+	case term == "tag" || term == "is":
+		for _, tag := range m.completionTags {
+			if strings.HasPrefix(tag, value) {
+				add(sign+term+":"+tag, start, "tag")
+			}
+		}
+
+	case term == "from" || term == "to":
+		for _, address := range knownAddresses() {
+			if strings.Contains(address, value) {
+				add(sign+term+":"+address, start, "address")
+			}
+		}
+
+	case term == "date":
+		for _, date := range dateCompletions {
+			if strings.HasPrefix(date, word) {
+				add(sign+date, start, "date")
+			}
+		}
+	}
+
+	return candidates
+}
+
+// addresses of all loaded messages
+func knownAddresses() []string {
+	var addresses []string
+	for _, message := range service.Messages().GetAll() {
+		for _, header := range []string{message.From, message.To} {
+			list, err := mail.ParseAddressList(header)
+			if err != nil {
+				continue
+			}
+			for _, address := range list {
+				addresses = append(addresses, strings.ToLower(address.Address))
+			}
+		}
+	}
+	slices.Sort(addresses)
+	return slices.Compact(addresses)
+}
+
+func (m *Model) renderCompletionPopup() string {
+	c := m.completion
+	if !c.active() {
+		return ""
+	}
+
+	// scroll the window so the selected candidate is visible
+	first := max(0, min(c.selected-completionPopupHeight/2, len(c.candidates)-completionPopupHeight))
+	last := min(len(c.candidates), first+completionPopupHeight)
+
+	width := 0
+	for _, candidate := range c.candidates[first:last] {
+		width = max(width, lipgloss.Width(candidate.Text)+lipgloss.Width(candidate.Source)+3)
+	}
+	width = min(width, m.width-2)
+
+	itemStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(colorForeground)).Background(bgColor())
+	selectedStyle := itemStyle.Foreground(lipgloss.Color(colorBackground)).Background(lipgloss.Color(colorSecondaryBright)).Bold(true)
+	sourceStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(colorMuted))
+
+	var lines []string
+	for i := first; i < last; i++ {
+		candidate := c.candidates[i]
+		style := itemStyle
+		if i == c.selected {
+			style = selectedStyle
+		}
+
+		text := truncate(candidate.Text, max(1, width-lipgloss.Width(candidate.Source)-3))
+		padding := max(1, width-lipgloss.Width(text)-lipgloss.Width(candidate.Source)-2)
+		lines = append(lines, style.Render(" "+text+strings.Repeat(" ", padding))+sourceStyle.Inherit(style).Render(candidate.Source+" "))
+	}
+
+	return " " + strings.Join(lines, "\n ")
+}
@@ -1,17 +1,52 @@
 package ui
 
-type Refresh struct{}
+import "github.com/vrld/ansicht/internal/model"
 
+// runs the startup code of the runtime in the update loop, which must be the
+// only goroutine that uses the Lua state
+type startupMsg struct{}
+
+// emits the quit event before quitting
+type QuitMsg struct{}
+
+// reloads the current query, or only the given messages if any
+type Refresh struct {
+	MessageIDs []model.MessageID
+}
+
+// the name of the query defaults to the beginning of the query string
 type QueryNewMsg struct {
-	Query string
+	Query model.SearchQuery
 }
 type QueryNextMsg struct{}
 type QueryPrevMsg struct{}
 
+// the queries were changed by the runtime, e.g., a tab was closed
+type QueryChangedMsg struct{}
+
 type MarksToggleMsg struct{}
 type MarksInvertMsg struct{}
 type MarksClearMsg struct{}
 
+type ThreadOpenMsg struct {
+	ThreadID string
+}
+type ThreadCloseMsg struct{}
+
+type PreviewToggleMsg struct{}
+type PreviewResizeMsg struct {
+	Lines    int
+	Relative bool
+}
+type PreviewScrollMsg struct {
+	Lines int
+}
+
+// sent when the next key of a key sequence did not arrive in time
+type KeySequenceTimeoutMsg struct {
+	Sequence int
+}
+
 type StatusSetMsg struct {
 	Message string
 }
@@ -26,3 +61,9 @@ type NotifyMsg struct {
 	Level   NotificationLevel
 	Timeout float64
 }
+
+// runs Func in the update loop and closes Done afterwards
+type ExecMsg struct {
+	Func func()
+	Done chan struct{}
+}
@@ -9,6 +9,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/vrld/ansicht/internal/model"
+	"github.com/vrld/ansicht/internal/runtime"
 	"github.com/vrld/ansicht/internal/service"
 )
 
@@ -16,6 +17,7 @@ import (
 type MessageItem struct {
 	Message *model.Message
 	Marked  bool
+	Depth   int
 }
 
 // FilterValue returns the value used for filtering the list
@@ -45,7 +47,9 @@ func ListItemsFromMessages() []list.Item {
 
 // MessageDelegate is a custom delegate for rendering message items
 type MessageDelegate struct {
-	width int
+	width   int
+	runtime RuntimeInterface
+	layout  runtime.ListLayout
 }
 
 type messageStyles struct {
@@ -101,6 +105,17 @@ func (d MessageDelegate) Render(w io.Writer, m list.Model, index int, listItem l
 		return
 	}
 
+	styles := itemStyles(m, index, item)
+	line, ok := d.renderSegments(m, index, item, styles)
+	if !ok {
+		line = d.renderLine(item, styles)
+	}
+
+	fmt.Fprint(w, line)
+}
+
+// styles depending on seen, selected and marked state
+func itemStyles(m list.Model, index int, item MessageItem) messageStyles {
 	var styles messageStyles
 	if item.Message.Flags.Seen {
 		styles = messageStylesSeen()
@@ -118,19 +133,58 @@ func (d MessageDelegate) Render(w io.Writer, m list.Model, index int, listItem l
 			withBackground(lipgloss.Color(colorBackground))
 	}
 
-	line := d.renderLine(item, styles)
+	return styles
+}
 
-	fmt.Fprint(w, line)
+// sender and recipient columns shrink to this width on narrow lists
+const (
+	minNameWidth = 10
+	maxNameWidth = 20
+)
+
+// columns of the built-in renderer, empty if hidden at the current width
+type messageColumns struct {
+	Date      string
+	Sender    string
+	Arrow     string
+	Recipient string
+	Tags      string
+}
+
+func (c messageColumns) width() int {
+	return lipgloss.Width(c.Date) + lipgloss.Width(c.Sender) + lipgloss.Width(c.Arrow) + lipgloss.Width(c.Recipient) + lipgloss.Width(c.Tags)
+}
+
+// the column is shown if the list is at least as wide as its breakpoint
+func (d MessageDelegate) showColumn(column string) bool {
+	return d.width >= d.layout.Breakpoints[column]
+}
+
+func (d MessageDelegate) columns(item MessageItem) messageColumns {
+	nameWidth := max(minNameWidth, min(maxNameWidth, (d.width-40)/3))
+
+	var columns messageColumns
+	if d.showColumn("date") {
+		columns.Date = fmt.Sprintf("%11s  ", formatDate(item.Message.Date))
+	}
+	columns.Sender = fmt.Sprintf("%*s", nameWidth, truncate(formatEmailAddress(item.Message.From), nameWidth)) // TODO: use only name (Sander <s@nd.er> => Sander)
+	if d.showColumn("recipient") {
+		columns.Arrow = " → "
+		columns.Recipient = fmt.Sprintf("%-*s", nameWidth, truncate(formatEmailAddress(item.Message.To), nameWidth))
+	}
+	if d.showColumn("tags") {
+		columns.Tags = "  " + truncate(formatTags(item.Message.Tags), max(1, d.width/4)) // TODO: replace tags (configurable)
+	}
+	return columns
 }
 
 func (d MessageDelegate) renderLine(item MessageItem, styles messageStyles) string {
-	date := fmt.Sprintf("%11s  ", formatDate(item.Message.Date))
-	sender := fmt.Sprintf("%20s", truncate(formatEmailAddress(item.Message.From), 20)) // TODO: use only name (Sander <s@nd.er> => Sander)
-	arrow := " → "
-	recipient := fmt.Sprintf("%-20s", truncate(formatEmailAddress(item.Message.To), 20))
-	tags := "  " + formatTags(item.Message.Tags) // TODO: replace tags (configurable)
+	columns := d.columns(item)
+	if d.Height() > 1 {
+		return d.renderLines(item, styles, columns)
+	}
 
-	componentWidth := lipgloss.Width(date) + lipgloss.Width(sender) + lipgloss.Width(arrow) + lipgloss.Width(recipient) + lipgloss.Width(tags)
+	componentWidth := columns.width()
 	remainingWidth := max(1, d.width-componentWidth)
 	subject := truncate("  "+cleanSubject(item.Message.Subject), remainingWidth)
 
@@ -140,16 +194,143 @@ func (d MessageDelegate) renderLine(item MessageItem, styles messageStyles) stri
 	}
 
 	return fmt.Sprintf("%s%s%s%s%s%s",
-		styles.Date.Render(date),
-		styles.Sender.Render(sender),
-		styles.Arrow.Render(arrow),
-		styles.Recipient.Render(recipient),
+		styles.Date.Render(columns.Date),
+		styles.Sender.Render(columns.Sender),
+		styles.Arrow.Render(columns.Arrow),
+		styles.Recipient.Render(columns.Recipient),
 		styles.Subject.Render(subject),
-		styles.Tags.Render(tags+filler))
+		styles.Tags.Render(columns.Tags+filler))
+}
+
+// a header line with date, sender, recipient and tags, and the subject below,
+// indented to the sender
+func (d MessageDelegate) renderLines(item MessageItem, styles messageStyles, columns messageColumns) string {
+	// names need no alignment when the subject is on its own line
+	columns.Sender = strings.TrimLeft(columns.Sender, " ")
+	columns.Recipient = strings.TrimRight(columns.Recipient, " ")
+
+	var filler string
+	if fillerWidth := d.width - columns.width(); fillerWidth > 0 {
+		filler = strings.Repeat(" ", fillerWidth)
+	}
+
+	header := fmt.Sprintf("%s%s%s%s%s",
+		styles.Date.Render(columns.Date),
+		styles.Sender.Render(columns.Sender),
+		styles.Arrow.Render(columns.Arrow),
+		styles.Recipient.Render(columns.Recipient),
+		styles.Tags.Render(filler+columns.Tags))
+
+	indent := strings.Repeat(" ", lipgloss.Width(columns.Date))
+	subject := truncate(indent+cleanSubject(item.Message.Subject), max(1, d.width))
+	if fillerWidth := d.width - lipgloss.Width(subject); fillerWidth > 0 {
+		subject += strings.Repeat(" ", fillerWidth)
+	}
+
+	lines := []string{header, styles.Subject.Render(subject)}
+	for len(lines) < d.Height() {
+		lines = append(lines, styles.Subject.Render(strings.Repeat(" ", d.width)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renders the item with ansicht.list.renderer, if it is set
+func (d MessageDelegate) renderSegments(m list.Model, index int, item MessageItem, styles messageStyles) (string, bool) {
+	if d.runtime == nil {
+		return "", false
+	}
+
+	segments, ok := d.runtime.RenderListItem(item.Message, runtime.ListItemContext{
+		Width:    d.width,
+		Index:    index,
+		Selected: index == m.Index(),
+		Marked:   item.Marked,
+		Seen:     item.Message.Flags.Seen,
+		Lines:    d.Height(),
+		Theme:    themeColors(),
+	})
+	if !ok {
+		return "", false
+	}
+
+	// a newline in a segment starts the next line, lines beyond the height are dropped
+	lines := make([]string, 0, d.Height())
+	var line strings.Builder
+	remainingWidth := d.width
+	endLine := func() {
+		if remainingWidth > 0 {
+			line.WriteString(styles.Tags.Render(strings.Repeat(" ", remainingWidth)))
+		}
+		lines = append(lines, line.String())
+		line.Reset()
+		remainingWidth = d.width
+	}
+
+	for _, segment := range segments {
+		style := segmentStyle(segment, styles).Inline(true)
+		for i, text := range strings.Split(segment.Text, "\n") {
+			if i > 0 {
+				endLine()
+			}
+			if remainingWidth <= 0 || text == "" {
+				continue
+			}
+			rendered := style.MaxWidth(remainingWidth).Render(text)
+			remainingWidth -= lipgloss.Width(rendered)
+			line.WriteString(rendered)
+		}
+	}
+	endLine()
+	for len(lines) < d.Height() {
+		endLine()
+	}
+
+	return strings.Join(lines[:d.Height()], "\n"), true
+}
+
+// the column style named by the segment, with the segment's colors and attributes
+func segmentStyle(segment runtime.ListSegment, styles messageStyles) lipgloss.Style {
+	var style lipgloss.Style
+	switch segment.Style {
+	case "date":
+		style = styles.Date
+	case "sender":
+		style = styles.Sender
+	case "arrow":
+		style = styles.Arrow
+	case "recipient":
+		style = styles.Recipient
+	case "tags":
+		style = styles.Tags
+	default:
+		style = styles.Subject
+	}
+
+	if segment.Foreground != "" {
+		style = style.Foreground(themeColor(segment.Foreground))
+	}
+	if segment.Background != "" {
+		style = style.Background(themeColor(segment.Background))
+	}
+	if segment.Bold {
+		style = style.Bold(true)
+	}
+	if segment.Italic {
+		style = style.Italic(true)
+	}
+	if segment.Underline {
+		style = style.Underline(true)
+	}
+	return style
+}
+
+// reads the layout from the config; the list pages by the height of the items
+func (m *Model) updateListLayout() {
+	m.list.SetDelegate(MessageDelegate{m.width - 2, m.runtime, m.runtime.ListLayout()})
 }
 
 // Height returns the height of a list item
-func (d MessageDelegate) Height() int { return 1 }
+func (d MessageDelegate) Height() int { return max(1, d.layout.Lines) }
 
 // Spacing returns the spacing between list items
 func (d MessageDelegate) Spacing() int { return 0 }
@@ -0,0 +1,47 @@
+package ui
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/vrld/ansicht/internal/runtime"
+)
+
+func TestResizeEventChangesListLayout(t *testing.T) {
+	resize := tea.WindowSizeMsg{Width: 80, Height: 40}
+
+	single := newTestModel(t, &fakeRuntime{})
+	updated, _ := single.Update(resize)
+	perPage := updated.(Model).list.Paginator.PerPage
+
+	r := &fakeRuntime{}
+	r.onEmit = func(event string, data map[string]any) {
+		if event == runtime.EventResize && data["width"].(int) < 100 {
+			r.layout.Lines = 2
+		}
+	}
+	double := newTestModel(t, r)
+	updated, _ = double.Update(resize)
+	if got := updated.(Model).list.Paginator.PerPage; got >= perPage {
+		t.Errorf("items per page = %d after the resize handler set two lines per item, want less than %d", got, perPage)
+	}
+}
+
+func TestEventHandlerChangesListLayout(t *testing.T) {
+	r := &fakeRuntime{}
+	m := newTestModel(t, r)
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+	perPage := updated.(Model).list.Paginator.PerPage
+
+	// e.g., in a results_loaded handler
+	r.onEmit = func(event string, data map[string]any) {
+		if event == runtime.EventResultsLoaded {
+			r.layout.Lines = 2
+		}
+	}
+	msg := SearchResultMsg{Stream: updated.(Model).stream, Done: true}
+	updated, _ = updated.(Model).Update(msg)
+	if got := updated.(Model).list.Paginator.PerPage; got >= perPage {
+		t.Errorf("items per page = %d after the event handler set two lines per item, want less than %d", got, perPage)
+	}
+}
@@ -1,41 +1,95 @@
 package ui
 
 import (
+	"time"
+
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/email"
 	"github.com/vrld/ansicht/internal/model"
 	"github.com/vrld/ansicht/internal/runtime"
 )
 
 // sent when a search completes
 type SearchResultMsg struct {
-	Result      model.SearchResult
-	Error       error
-	RowToSelect int
-	QueryString string
+	Result     model.SearchResult
+	Error      error
+	Reload     bool // the query was searched again: keep marks and selection
+	Background bool // the database changed, see watch.go
+	Append     bool // the next chunk of the results, see stream.go
+	Done       bool // there are no more results
+	Query      model.SearchQuery
+	Stream     *db.ThreadStream
+}
+
+// sent when single messages were re-read from the database
+type MessagesRefreshedMsg struct {
+	Updated []model.Message
+	Removed []model.MessageID
+	Error   error
+	Query   model.SearchQuery
+}
+
+// sent when the thread for the thread view was read
+type ThreadLoadedMsg struct {
+	ThreadID string
+	Thread   model.Thread
+	Nodes    []model.ThreadNode
+	Error    error
 }
 
 type RuntimeInterface interface {
 	OnStartup()
 	OnKey(keycode string) (handledKey bool)
 	HandleInput(input string)
+	Complete(word, input string) []string
 	HandleSpawnResult(msg runtime.SpawnResult)
+	Emit(event string, data map[string]any)
+	PendingKeys() []string
+	ResetPendingKeys()
+	KeyTimeout() time.Duration
+	WatchInterval() time.Duration
+	TabFormat() string
+	TabCountQuery(name string) string
+	RenderListItem(message *model.Message, ctx runtime.ListItemContext) ([]runtime.ListSegment, bool)
+	ListLayout() runtime.ListLayout
+	Mode() string
 }
 
 type Model struct {
-	runtime            RuntimeInterface
-	isLoading          bool
-	focusInput         bool
-	currentQueryString string
-	list               list.Model
-	input              textinput.Model
-	spinner            spinner.Model
-	width              int
-	height             int
-	notifications      []Notification
+	runtime          RuntimeInterface
+	isLoading        bool
+	focusInput       bool
+	currentQuery     model.SearchQuery
+	stream           *db.ThreadStream
+	loadingResults   bool
+	resultsComplete  bool
+	list             list.Model
+	threadList       list.Model
+	threadID         string
+	preview          viewport.Model
+	showPreview      bool
+	previewHeight    int
+	previewID        model.MessageID
+	previewContent   *email.Content
+	selectedID       model.MessageID
+	keySequence      int
+	input            textinput.Model
+	completion       completion
+	completionTags   []string
+	spinner          spinner.Model
+	width            int
+	height           int
+	notifications    []Notification
+	tabCounts        map[tabCountKey]tabCount
+	xapianDir        string
+	databaseModified time.Time
+	pendingReload    bool
 }
 
 func NewModel(runtime RuntimeInterface) *Model {
@@ -54,8 +108,22 @@ func NewModel(runtime RuntimeInterface) *Model {
 	// Default width (will be updated on WindowSizeMsg)
 	defaultWidth := 96
 
-	// Create the message list with a custom delegate
-	messageList := list.New([]list.Item{}, MessageDelegate{defaultWidth}, defaultWidth, 20)
+	return &Model{
+		runtime:       runtime,
+		focusInput:    false,
+		input:         ti,
+		list:          newMessageList(MessageDelegate{defaultWidth, runtime, runtime.ListLayout()}, defaultWidth),
+		threadList:    newMessageList(ThreadDelegate{defaultWidth}, defaultWidth),
+		preview:       viewport.New(defaultWidth, 0),
+		spinner:       sp,
+		width:         defaultWidth,
+		notifications: make([]Notification, 0),
+	}
+}
+
+// Create a message list with a custom delegate
+func newMessageList(delegate list.ItemDelegate, width int) list.Model {
+	messageList := list.New([]list.Item{}, delegate, width, 20)
 	messageList.SetShowStatusBar(false)
 	messageList.SetFilteringEnabled(false)
 	messageList.SetShowTitle(false)
@@ -67,20 +135,10 @@ func NewModel(runtime RuntimeInterface) *Model {
 	messageList.Styles = list.DefaultStyles()
 	messageList.Styles.NoItems = lipgloss.NewStyle().Bold(true).Align(lipgloss.Center, lipgloss.Center)
 
-	return &Model{
-		runtime:       runtime,
-		focusInput:    false,
-		input:         ti,
-		list:          messageList,
-		spinner:       sp,
-		width:         defaultWidth,
-		notifications: make([]Notification, 0),
-	}
+	return messageList
 }
 
+// Lua runs only in Update, see startupMsg
 func (m Model) Init() tea.Cmd {
-	return func() tea.Msg {
-		m.runtime.OnStartup()
-		return Refresh{}
-	}
+	return func() tea.Msg { return startupMsg{} }
 }
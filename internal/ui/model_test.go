@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vrld/ansicht/internal/model"
+	"github.com/vrld/ansicht/internal/runtime"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// a runtime without Lua that records the emitted events
+type fakeRuntime struct {
+	layout        runtime.ListLayout
+	watchInterval time.Duration
+	events        []string
+	onEmit        func(event string, data map[string]any)
+}
+
+func (r *fakeRuntime) OnStartup()                            {}
+func (r *fakeRuntime) OnKey(string) bool                     { return false }
+func (r *fakeRuntime) HandleInput(string)                    {}
+func (r *fakeRuntime) Complete(string, string) []string      { return nil }
+func (r *fakeRuntime) HandleSpawnResult(runtime.SpawnResult) {}
+func (r *fakeRuntime) PendingKeys() []string                 { return nil }
+func (r *fakeRuntime) ResetPendingKeys()                     {}
+func (r *fakeRuntime) KeyTimeout() time.Duration             { return time.Second }
+func (r *fakeRuntime) WatchInterval() time.Duration          { return 0 }
+func (r *fakeRuntime) TabFormat() string                     { return "{name}" }
+func (r *fakeRuntime) TabCountQuery(string) string           { return "" }
+func (r *fakeRuntime) ListLayout() runtime.ListLayout        { return r.layout }
+func (r *fakeRuntime) Mode() string                          { return "" }
+
+func (r *fakeRuntime) RenderListItem(*model.Message, runtime.ListItemContext) ([]runtime.ListSegment, bool) {
+	return nil, false
+}
+
+func (r *fakeRuntime) Emit(event string, data map[string]any) {
+	r.events = append(r.events, event)
+	if r.onEmit != nil {
+		r.onEmit(event, data)
+	}
+}
+
+// Returns a model showing the message list. The notmuch config does not exist,
+// so the queries are the defaults, and nothing is read from a database unless
+// a returned command is run.
+func newTestModel(t *testing.T, r *fakeRuntime) *Model {
+	t.Helper()
+
+	t.Setenv("NOTMUCH_CONFIG", filepath.Join(t.TempDir(), "config"))
+	if r.layout.Lines == 0 {
+		r.layout.Lines = 1
+	}
+	service.View().Set(service.ViewList)
+
+	m := NewModel(r)
+	t.Cleanup(func() {
+		if m.stream != nil {
+			m.stream.Close()
+		}
+	})
+	return m
+}
@@ -0,0 +1,153 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/vrld/ansicht/internal/email"
+	"github.com/vrld/ansicht/internal/model"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// the preview never gets smaller than this, and leaves at least this much for the list
+const minPreviewHeight = 3
+
+// sent when the message for the preview was read
+type PreviewLoadedMsg struct {
+	MessageID model.MessageID
+	Content   *email.Content
+	Error     error
+}
+
+// lines inside the mails border: everything but tabs, status line and bottom border
+func (m *Model) mailsInnerHeight() int {
+	return max(0, m.height-5)
+}
+
+// height of the preview pane, not including the separator
+func (m *Model) previewPaneHeight() int {
+	available := m.mailsInnerHeight() - 1
+	height := m.previewHeight
+	if height <= 0 {
+		height = available / 2
+	}
+	return max(0, min(max(height, minPreviewHeight), available-minPreviewHeight))
+}
+
+func (m *Model) layoutPreview() {
+	m.preview.Width = m.width - 2
+	m.preview.Height = m.previewPaneHeight()
+	m.preview.SetContent(renderPreviewContent(m.previewContent, m.preview.Width))
+
+	// View works on a copy of the model, so the lists keep their height only if set here
+	m.list.SetHeight(m.listHeight())
+	m.threadList.SetHeight(m.listHeight())
+}
+
+// lines of the message lists: the mails pane without the preview
+func (m *Model) listHeight() int {
+	height := m.mailsInnerHeight()
+	if m.showPreview {
+		height -= m.preview.Height + 1
+	}
+	return max(1, height)
+}
+
+func (m *Model) togglePreview() tea.Cmd {
+	m.showPreview = !m.showPreview
+	m.layoutPreview()
+	return m.loadPreview()
+}
+
+func (m *Model) resizePreview(lines int, relative bool) {
+	if relative {
+		lines += m.previewPaneHeight()
+	}
+	m.previewHeight = max(minPreviewHeight, lines)
+	m.layoutPreview()
+}
+
+// reads the selected message if the preview shows a different one
+func (m *Model) loadPreview() tea.Cmd {
+	if !m.showPreview {
+		return nil
+	}
+
+	message := service.ActiveMessages().Get(m.activeList().Index())
+	if message == nil {
+		m.previewID = ""
+		m.previewContent = nil
+		m.layoutPreview()
+		return nil
+	}
+
+	if message.ID == m.previewID {
+		return nil
+	}
+	m.previewID = message.ID
+
+	id, filename := message.ID, message.Filename
+	return func() tea.Msg {
+		content, err := email.ReadFile(filename)
+		return PreviewLoadedMsg{MessageID: id, Content: content, Error: err}
+	}
+}
+
+func (m *Model) showPreviewContent(msg PreviewLoadedMsg) {
+	if msg.MessageID != m.previewID {
+		return
+	}
+
+	if msg.Error != nil {
+		service.Logger().Error(msg.Error.Error())
+		if msg.Content == nil {
+			msg.Content = &email.Content{Body: msg.Error.Error()}
+		}
+	}
+
+	m.previewContent = msg.Content
+	m.layoutPreview()
+	m.preview.GotoTop()
+}
+
+func renderPreviewContent(content *email.Content, width int) string {
+	if content == nil || width <= 0 {
+		return ""
+	}
+
+	nameStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(colorMuted)).Background(bgColor())
+	valueStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(colorHighlight)).Background(bgColor())
+	bodyStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(colorForeground)).Background(bgColor()).Width(width)
+	attachmentStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(colorTertiary)).Background(bgColor())
+
+	var lines []string
+	for _, header := range content.Headers {
+		name := fmt.Sprintf("%8s: ", header.Name)
+		value := truncate(cleanSubject(header.Value), max(1, width-lipgloss.Width(name)))
+		lines = append(lines, nameStyle.Render(name)+valueStyle.Render(value))
+	}
+
+	lines = append(lines, "", bodyStyle.Render(strings.ReplaceAll(content.Body, "\t", "    ")))
+
+	if len(content.Attachments) > 0 {
+		lines = append(lines, "")
+	}
+	for _, attachment := range content.Attachments {
+		name := attachment.Filename
+		if name == "" {
+			name = "(unnamed)"
+		}
+		line := fmt.Sprintf("📎 %s (%s, %s)", name, attachment.ContentType, formatSize(attachment.Size))
+		lines = append(lines, attachmentStyle.Render(truncate(line, width)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (m *Model) renderPreview() string {
+	separator := lipgloss.NewStyle().Foreground(borderColor()).Background(bgColor()).
+		Render(strings.Repeat("─", max(0, m.width-2)))
+	return separator + "\n" + m.preview.View()
+}
@@ -1,7 +1,10 @@
 package ui
 
 import (
+	"context"
+
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/vrld/ansicht/internal/model"
 	"github.com/vrld/ansicht/internal/runtime"
 	"github.com/vrld/ansicht/internal/service"
 )
@@ -11,11 +14,11 @@ type RuntimeAdapter struct {
 }
 
 func (a *RuntimeAdapter) Quit() {
-	go a.Program.Send(tea.QuitMsg{})
+	go a.Program.Send(QuitMsg{})
 }
 
-func (a *RuntimeAdapter) Refresh() {
-	go a.Program.Send(Refresh{})
+func (a *RuntimeAdapter) Refresh(messages []model.MessageID) {
+	go a.Program.Send(Refresh{MessageIDs: messages})
 }
 
 func (a *RuntimeAdapter) Status(message string) {
@@ -48,8 +51,8 @@ func (a *RuntimeAdapter) SpawnResult(result runtime.SpawnResult) {
 	go a.Program.Send(result)
 }
 
-func (a *RuntimeAdapter) QueryNew(query string) {
-	go a.Program.Send(QueryNewMsg{query})
+func (a *RuntimeAdapter) QueryNew(query model.SearchQuery) {
+	go a.Program.Send(QueryNewMsg{Query: query})
 }
 
 func (a *RuntimeAdapter) QuerySelectNext() {
@@ -60,6 +63,10 @@ func (a *RuntimeAdapter) QuerySelectPrev() {
 	go a.Program.Send(QueryPrevMsg{})
 }
 
+func (a *RuntimeAdapter) QueryChanged() {
+	go a.Program.Send(QueryChangedMsg{})
+}
+
 func (a *RuntimeAdapter) MarksToggle() {
 	go a.Program.Send(MarksToggleMsg{})
 }
@@ -72,6 +79,41 @@ func (a *RuntimeAdapter) MarksClear() {
 	go a.Program.Send(MarksClearMsg{})
 }
 
+func (a *RuntimeAdapter) ThreadOpen(threadID string) {
+	go a.Program.Send(ThreadOpenMsg{threadID})
+}
+
+func (a *RuntimeAdapter) ThreadClose() {
+	go a.Program.Send(ThreadCloseMsg{})
+}
+
+func (a *RuntimeAdapter) PreviewToggle() {
+	go a.Program.Send(PreviewToggleMsg{})
+}
+
+func (a *RuntimeAdapter) PreviewResize(lines int, relative bool) {
+	go a.Program.Send(PreviewResizeMsg{Lines: lines, Relative: relative})
+}
+
+func (a *RuntimeAdapter) PreviewScroll(lines int) {
+	go a.Program.Send(PreviewScrollMsg{Lines: lines})
+}
+
+// Runs f in the update loop, so it may use the runtime and services. Returns
+// the error of ctx if f did not return before ctx is done, e.g., because the
+// program has quit. Then f may still run later.
+func (a *RuntimeAdapter) Exec(ctx context.Context, f func()) error {
+	done := make(chan struct{})
+	go a.Program.Send(ExecMsg{Func: f, Done: done})
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (a *RuntimeAdapter) SetTheme(theme any) {
 	if theme, ok := theme.(runtime.ThemeData); ok {
 		colorBackground = theme.Background
@@ -0,0 +1,66 @@
+package ui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/model"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// Search results are read in chunks: the first chunk is shown as soon as it
+// is read, and the next one when the selection comes close to the end of the
+// list. Starting a new search closes the stream of the previous one.
+//
+// Until the last chunk is read, everything that works on the list, e.g.,
+// ansicht.messages.all(), ansicht.threads.all(), ansicht.marks.invert() or
+// the remote marked command, sees only the messages read so far. The
+// results_loaded event tells whether the results are complete.
+
+// starts a new search of the current query and reads the first chunk
+func (m *Model) searchCurrentQuery(reload, background bool) tea.Cmd {
+	query, ok := service.Queries().Current()
+	if !ok {
+		return nil
+	}
+
+	if m.stream != nil {
+		m.stream.Close()
+	}
+	m.stream = db.StreamThreads(query)
+	m.resultsComplete = false
+	m.loadingResults = true
+
+	// a reload reads as many threads as are shown, to keep the selection
+	n := db.ThreadChunkSize
+	if reload {
+		n = max(n, service.Messages().ThreadCount())
+	}
+	return readResults(m.stream, n, SearchResultMsg{Reload: reload, Background: background})
+}
+
+// reads the next chunk if the selection is within two pages of the end of the list
+func (m *Model) loadMoreResults() tea.Cmd {
+	if m.stream == nil || m.resultsComplete || m.loadingResults {
+		return nil
+	}
+	if m.list.Index() < len(m.list.Items())-2*m.list.Paginator.PerPage {
+		return nil
+	}
+
+	m.loadingResults = true
+	return readResults(m.stream, db.ThreadChunkSize, SearchResultMsg{Append: true})
+}
+
+func readResults(stream *db.ThreadStream, n int, msg SearchResultMsg) tea.Cmd {
+	return func() tea.Msg {
+		chunk := stream.Next(n)
+		query := stream.Query()
+
+		msg.Stream = stream
+		msg.Query = query
+		msg.Result = model.SearchResult{Query: &query, Threads: chunk.Threads}
+		msg.Error = chunk.Error
+		msg.Done = chunk.Done
+		return msg
+	}
+}
@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/model"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+type tabCountKey struct {
+	Query        string
+	CountQuery   string
+	OmitExcluded bool
+}
+
+type tabCount struct {
+	Count int
+	Total int
+}
+
+// sent when the messages of all tabs were counted
+type TabCountsMsg struct {
+	Counts map[tabCountKey]tabCount
+	Error  error
+}
+
+func (m *Model) tabCountKey(query model.SearchQuery) tabCountKey {
+	return tabCountKey{
+		Query:        query.Query,
+		CountQuery:   m.runtime.TabCountQuery(query.Name),
+		OmitExcluded: query.OmitExcluded,
+	}
+}
+
+// counts the messages of all tabs in the background, if the tab format shows counts
+func (m *Model) countTabs() tea.Cmd {
+	format := m.runtime.TabFormat()
+	if !strings.Contains(format, "{count}") && !strings.Contains(format, "{total}") {
+		return nil
+	}
+
+	var keys []tabCountKey
+	seen := make(map[tabCountKey]bool)
+	for _, query := range service.Queries().All() {
+		if key := m.tabCountKey(query); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	return func() tea.Msg {
+		queries := make([]model.SearchQuery, 0, 2*len(keys))
+		for _, key := range keys {
+			countQuery := key.Query
+			if key.CountQuery != "" {
+				countQuery = "(" + key.Query + ") and (" + key.CountQuery + ")"
+			}
+			queries = append(queries,
+				model.SearchQuery{Query: key.Query, OmitExcluded: key.OmitExcluded},
+				model.SearchQuery{Query: countQuery, OmitExcluded: key.OmitExcluded},
+			)
+		}
+
+		numbers, err := db.CountMessages(queries)
+		if err != nil {
+			return TabCountsMsg{Error: err}
+		}
+
+		counts := make(map[tabCountKey]tabCount, len(keys))
+		for i, key := range keys {
+			counts[key] = tabCount{Total: numbers[2*i], Count: numbers[2*i+1]}
+		}
+		return TabCountsMsg{Counts: counts}
+	}
+}
+
+// the tab label according to ansicht.tabs.format
+func (m *Model) tabLabel(query model.SearchQuery, format string) string {
+	count, total := "…", "…"
+	if counts, ok := m.tabCounts[m.tabCountKey(query)]; ok {
+		count, total = strconv.Itoa(counts.Count), strconv.Itoa(counts.Total)
+	}
+
+	return strings.NewReplacer(
+		"{name}", query.Name,
+		"{count}", count,
+		"{total}", total,
+	).Replace(format)
+}
@@ -1,5 +1,7 @@
 package ui
 
+import "github.com/charmbracelet/lipgloss"
+
 var (
 	colorBackground = "0"
 	colorMuted      = "8"
@@ -17,3 +19,29 @@ var (
 	colorWarning = "13"
 	colorError   = "9"
 )
+
+// theme colors by the names of ansicht.theme.set
+func themeColors() map[string]string {
+	return map[string]string{
+		"background":       colorBackground,
+		"muted":            colorMuted,
+		"foreground":       colorForeground,
+		"highlight":        colorHighlight,
+		"accent":           colorAccent,
+		"secondary":        colorSecondary,
+		"tertiary":         colorTertiary,
+		"accent_bright":    colorAccentBright,
+		"secondary_bright": colorSecondaryBright,
+		"tertiary_bright":  colorTertiaryBright,
+		"warning":          colorWarning,
+		"error":            colorError,
+	}
+}
+
+// a theme color name, or any color lipgloss understands
+func themeColor(name string) lipgloss.Color {
+	if color, ok := themeColors()[name]; ok {
+		return lipgloss.Color(color)
+	}
+	return lipgloss.Color(name)
+}
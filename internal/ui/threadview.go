@@ -0,0 +1,130 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// deeper replies are not indented any further
+const maxIndentDepth = 12
+
+func ThreadItemsFromMessages() []list.Item {
+	var items []list.Item
+
+	for row, message := range service.ThreadMessages().GetAll() {
+		items = append(items, MessageItem{
+			Message: message,
+			Marked:  service.ThreadMessages().IsMarked(row),
+			Depth:   service.ThreadMessages().Depth(row),
+		})
+	}
+
+	return items
+}
+
+// ThreadDelegate renders the messages of a thread as an indented reply tree
+type ThreadDelegate struct {
+	width int
+}
+
+// Render renders a list item
+func (d ThreadDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	item, ok := listItem.(MessageItem)
+	if !ok || item.Message == nil {
+		return
+	}
+
+	line := d.renderLine(item, itemStyles(m, index, item))
+
+	fmt.Fprint(w, line)
+}
+
+func (d ThreadDelegate) renderLine(item MessageItem, styles messageStyles) string {
+	date := fmt.Sprintf("%11s  ", formatDate(item.Message.Date))
+
+	var indent string
+	if depth := min(item.Depth, maxIndentDepth); depth > 0 {
+		indent = strings.Repeat("  ", depth-1) + "└ "
+	}
+
+	sender := truncate(formatEmailAddress(item.Message.From), 20)
+	tags := "  " + formatTags(item.Message.Tags)
+
+	componentWidth := lipgloss.Width(date) + lipgloss.Width(indent) + lipgloss.Width(sender) + lipgloss.Width(tags)
+	remainingWidth := max(1, d.width-componentWidth)
+	subject := truncate("  "+cleanSubject(item.Message.Subject), remainingWidth)
+
+	var filler string
+	if fillerWidth := d.width - componentWidth - lipgloss.Width(subject); fillerWidth > 0 {
+		filler = strings.Repeat(" ", fillerWidth)
+	}
+
+	return fmt.Sprintf("%s%s%s%s%s",
+		styles.Date.Render(date),
+		styles.Arrow.Render(indent),
+		styles.Sender.Render(sender),
+		styles.Subject.Render(subject),
+		styles.Tags.Render(tags+filler))
+}
+
+// Height returns the height of a list item
+func (d ThreadDelegate) Height() int { return 1 }
+
+// Spacing returns the spacing between list items
+func (d ThreadDelegate) Spacing() int { return 0 }
+
+// Update handles key messages
+func (d ThreadDelegate) Update(msg tea.Msg, m *list.Model) tea.Cmd {
+	return nil // Message selection is handled in the main Update function
+}
+
+func (m *Model) isThreadOpen() bool {
+	return service.View().Get() == service.ViewThread
+}
+
+// the list of the view that is currently shown
+func (m *Model) activeList() *list.Model {
+	if m.isThreadOpen() {
+		return &m.threadList
+	}
+	return &m.list
+}
+
+func (m *Model) loadThread(threadID string) tea.Cmd {
+	m.threadID = threadID
+	m.isLoading = true
+	return tea.Batch(func() tea.Msg {
+		thread, nodes, err := db.FindThreadTree(threadID)
+		return ThreadLoadedMsg{ThreadID: threadID, Thread: thread, Nodes: nodes, Error: err}
+	}, m.spinner.Tick)
+}
+
+func (m *Model) openThread(msg ThreadLoadedMsg) {
+	if m.isThreadOpen() {
+		service.ThreadMessages().Select(m.threadList.Index())
+	}
+	service.ThreadMessages().SetThreadTree(msg.Thread, msg.Nodes)
+	service.View().Set(service.ViewThread)
+	m.updateThreadList(service.ThreadMessages().Selected())
+}
+
+// go back to the message list, which still has its previous cursor
+func (m *Model) closeThread() {
+	m.threadID = ""
+	service.View().Set(service.ViewList)
+	service.Messages().Select(m.list.Index())
+}
+
+func (m *Model) updateThreadList(toSelect int) {
+	m.threadList.SetItems(ThreadItemsFromMessages())
+	toSelect = max(0, min(toSelect, len(m.threadList.Items())-1))
+	m.threadList.Select(toSelect)
+	service.ThreadMessages().Select(toSelect)
+}
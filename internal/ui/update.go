@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"time"
+
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/vrld/ansicht/internal/db"
@@ -11,63 +13,204 @@ import (
 
 // Update handles messages and updates the model
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	m, cmd := m.update(msg)
+	m.emitSelectionChanged()
+
+	// Lua code may have changed ansicht.list in any key binding or event
+	// handler, e.g., on resize, or in remote code
+	m.updateListLayout()
+
+	// follow the selection in the preview pane, reload if the database changed
+	// while loading, and read more results when the selection comes close to
+	// the end of the list. These change m, so they must run before it is returned.
+	preview := m.loadPreview()
+	reload := m.runPendingReload()
+	more := m.loadMoreResults()
+	return m, tea.Batch(cmd, preview, reload, more)
+}
+
+func (m Model) update(msg tea.Msg) (Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case startupMsg:
+		// the startup code may set ansicht.watch_interval
+		m.runtime.OnStartup()
+		return m, tea.Batch(func() tea.Msg { return Refresh{} }, m.watchDatabase())
+
 	case SearchResultMsg:
-		// Only process if this result matches the current query
-		if msg.QueryString == m.currentQueryString {
-			m.isLoading = false
+		// Only process if this result belongs to the current search
+		if msg.Stream == m.stream {
+			if !msg.Background {
+				m.isLoading = false
+			}
+			m.loadingResults = false
+			m.resultsComplete = msg.Done
 			if msg.Error != nil {
 				service.Logger().Error(msg.Error.Error())
-				// TODO: Show error in UI
-				return m, nil
+				return m, m.AddNotification(msg.Error.Error(), NotificationError, 0)
+			}
+			added := 0
+			switch {
+			case msg.Append:
+				service.Messages().Select(m.list.Index())
+				service.Messages().AppendThreads(msg.Result.Threads)
+			case msg.Reload:
+				service.Messages().Select(m.list.Index())
+				added = service.Messages().ReloadThreads(msg.Result.Threads)
+			default:
+				service.Messages().SetThreads(msg.Result.Threads)
+			}
+			m.updateList(service.Messages().Selected())
+			m.runtime.Emit(runtime.EventResultsLoaded, map[string]any{
+				"query":    msg.Query.Query,
+				"count":    service.Messages().Count(),
+				"complete": msg.Done,
+			})
+			if msg.Background && added > 0 {
+				m.runtime.Emit(runtime.EventNewMail, map[string]any{
+					"query": msg.Query.Query,
+					"count": added,
+				})
 			}
-			service.Messages().SetThreads(msg.Result.Threads)
-			m.updateList(msg.RowToSelect)
 		}
 		return m, nil
 
+	case DatabaseCheckMsg:
+		return m, m.handleDatabaseCheck(msg)
+
+	case ThreadOpenMsg:
+		return m, m.loadThread(msg.ThreadID)
+
+	case ThreadLoadedMsg:
+		if msg.ThreadID != m.threadID {
+			return m, nil
+		}
+		m.isLoading = false
+		if msg.Error != nil {
+			service.Logger().Error(msg.Error.Error())
+			m.threadID = ""
+			return m, m.AddNotification(msg.Error.Error(), NotificationError, 0)
+		}
+		m.openThread(msg)
+		return m, nil
+
+	case ThreadCloseMsg:
+		m.closeThread()
+		return m, nil
+
+	case MessagesRefreshedMsg:
+		if !msg.Query.SameSearch(m.currentQuery) {
+			return m, nil
+		}
+		if msg.Error != nil {
+			service.Logger().Error(msg.Error.Error())
+			return m, m.AddNotification(msg.Error.Error(), NotificationError, 0)
+		}
+		m.patchList(msg.Updated, msg.Removed)
+		return m, nil
+
 	case tea.WindowSizeMsg:
 		m.setLayoutDimension(msg.Width, msg.Height)
 		m.updateList(m.list.Index())
+		m.layoutPreview()
+		m.runtime.Emit(runtime.EventResize, map[string]any{
+			"width":  msg.Width,
+			"height": msg.Height,
+		})
+
+		return m, nil
+
+	case QuitMsg:
+		m.runtime.Emit(runtime.EventQuit, nil)
+		return m, tea.Quit
 
+	case PreviewToggleMsg:
+		return m, m.togglePreview()
+
+	case PreviewResizeMsg:
+		m.resizePreview(msg.Lines, msg.Relative)
+		return m, nil
+
+	case PreviewScrollMsg:
+		if msg.Lines < 0 {
+			m.preview.ScrollUp(-msg.Lines)
+		} else {
+			m.preview.ScrollDown(msg.Lines)
+		}
+		return m, nil
+
+	case PreviewLoadedMsg:
+		m.showPreviewContent(msg)
 		return m, nil
 
 	// reload the current query
 	case Refresh:
-		return m, m.loadCurrentQuery(m.list.Index())
+		var cmd tea.Cmd
+		if len(msg.MessageIDs) > 0 {
+			cmd = m.refreshMessages(msg.MessageIDs)
+		} else {
+			cmd = m.reloadCurrentQuery()
+		}
+		if m.isThreadOpen() {
+			cmd = tea.Batch(cmd, m.loadThread(m.threadID))
+		}
+		return m, tea.Batch(cmd, m.countTabs())
+
+	case TabCountsMsg:
+		if msg.Error != nil {
+			service.Logger().Error(msg.Error.Error())
+			return m, nil
+		}
+		m.tabCounts = msg.Counts
+		return m, nil
 
 	// new query
 	case QueryNewMsg:
-		service.Queries().Add(model.SearchQuery{
-			Query: msg.Query,
-			Name:  truncate(msg.Query, 10),
-		})
+		query := msg.Query
+		if query.Name == "" {
+			query.Name = truncate(query.Query, 10)
+		}
+		service.Queries().Add(query)
 		service.Queries().SelectLast()
-		return m, m.loadCurrentQuery(0)
+		m.emitQueryChanged()
+		return m, tea.Batch(m.loadCurrentQuery(), m.countTabs())
 
 	// switch between queries
 	case QueryNextMsg:
 		service.Queries().SelectNext()
-		return m, m.loadCurrentQuery(0)
+		m.emitQueryChanged()
+		return m, m.loadCurrentQuery()
 
 	case QueryPrevMsg:
 		service.Queries().SelectPrevious()
-		return m, m.loadCurrentQuery(0)
+		m.emitQueryChanged()
+		return m, m.loadCurrentQuery()
+
+	// tabs were closed, renamed, moved, selected or replaced
+	case QueryChangedMsg:
+		cmd := m.countTabs()
+		if query, ok := service.Queries().Current(); ok && !query.SameSearch(m.currentQuery) {
+			m.emitQueryChanged()
+			cmd = tea.Batch(cmd, m.loadCurrentQuery())
+		}
+		return m, cmd
 
 	// item selection
 	case MarksToggleMsg:
-		service.Messages().ToggleMark(m.list.Index())
-		m.updateList(m.list.Index())
+		service.ActiveMessages().ToggleMark(m.activeList().Index())
+		m.updateActiveList()
+		m.emitMarksChanged()
 		return m, nil
 
 	case MarksInvertMsg:
-		service.Messages().InvertMarks()
-		m.updateList(m.list.Index())
+		service.ActiveMessages().InvertMarks()
+		m.updateActiveList()
+		m.emitMarksChanged()
 		return m, nil
 
 	case MarksClearMsg:
-		service.Messages().ClearMarks()
-		m.updateList(m.list.Index())
+		service.ActiveMessages().ClearMarks()
+		m.updateActiveList()
+		m.emitMarksChanged()
 		return m, nil
 
 	case OpenInputEvent:
@@ -75,10 +218,35 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.input.Placeholder = msg.Placeholder
 		m.input.Prompt = msg.Prompt
 		m.input.Focus()
+		m.resetCompletion()
+		m.runtime.Emit(runtime.EventInputOpened, map[string]any{
+			"prompt":      msg.Prompt,
+			"placeholder": msg.Placeholder,
+		})
+		return m, loadCompletionTags
+
+	case CompletionTagsMsg:
+		if msg.Error != nil {
+			service.Logger().Error(msg.Error.Error())
+		}
+		m.completionTags = msg.Tags
 		return m, nil
 
 	case runtime.SpawnResult:
 		m.runtime.HandleSpawnResult(msg)
+		m.runtime.Emit(runtime.EventSpawnFinished, msg.EventData())
+		return m, nil
+
+	case KeySequenceTimeoutMsg:
+		if msg.Sequence == m.keySequence {
+			m.runtime.ResetPendingKeys()
+		}
+		return m, nil
+
+	case ExecMsg:
+		msg.Func()
+		close(msg.Done)
+		m.updateActiveList()
 		return m, nil
 
 	case NotificationExpiredMsg:
@@ -92,6 +260,17 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// key presses
 	case tea.KeyMsg:
 		if m.focusInput {
+			switch msg.String() {
+			case "tab":
+				m.complete(1)
+				return m, nil
+
+			case "shift+tab":
+				m.complete(-1)
+				return m, nil
+			}
+
+			m.resetCompletion()
 			switch msg.String() {
 			case "enter":
 				if query := m.input.Value(); query != "" {
@@ -121,9 +300,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 		} else {
-			service.Messages().Select(m.list.Index())
+			service.ActiveMessages().Select(m.activeList().Index())
 			if m.runtime.OnKey(msg.String()) {
-				return m, nil
+				return m, m.waitForKeySequence()
 			}
 		}
 	}
@@ -135,6 +314,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if m.focusInput {
 		m.input, cmd = m.input.Update(msg)
 		cmds = append(cmds, cmd)
+	} else if m.isThreadOpen() {
+		m.threadList, cmd = m.threadList.Update(msg)
+		cmds = append(cmds, cmd)
 	} else {
 		m.list, cmd = m.list.Update(msg)
 		cmds = append(cmds, cmd)
@@ -148,26 +330,118 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
-func (m *Model) searchCurrentQuery(rowToSelect int) tea.Cmd {
-	return func() tea.Msg {
-		if query, ok := service.Queries().Current(); ok {
-			result, err := db.FindThreads(&query)
-			return SearchResultMsg{Result: result, Error: err, RowToSelect: rowToSelect, QueryString: query.Query}
-		}
+// cancels an unfinished key sequence if the next key does not arrive in time
+func (m *Model) waitForKeySequence() tea.Cmd {
+	m.keySequence++
+	if len(m.runtime.PendingKeys()) == 0 {
 		return nil
 	}
+
+	sequence := m.keySequence
+	return tea.Tick(m.runtime.KeyTimeout(), func(time.Time) tea.Msg {
+		return KeySequenceTimeoutMsg{Sequence: sequence}
+	})
+}
+
+func (m *Model) emitQueryChanged() {
+	query, ok := service.Queries().Current()
+	if !ok {
+		return
+	}
+
+	m.runtime.Emit(runtime.EventQueryChanged, map[string]any{
+		"query": query.Query,
+		"name":  query.Name,
+		"index": service.Queries().SelectedIndex() + 1,
+	})
+}
+
+func (m *Model) emitMarksChanged() {
+	m.runtime.Emit(runtime.EventMarksChanged, map[string]any{
+		"count":  service.ActiveMessages().MarkedCount(),
+		"marked": service.ActiveMessages().GetMarked(),
+	})
+}
+
+func (m *Model) emitSelectionChanged() {
+	message := service.ActiveMessages().Get(m.activeList().Index())
+
+	var id model.MessageID
+	if message != nil {
+		id = message.ID
+	}
+	if id == m.selectedID {
+		return
+	}
+	m.selectedID = id
+
+	m.runtime.Emit(runtime.EventSelectionChanged, map[string]any{
+		"message": message,
+		"view":    service.View().Get(),
+	})
 }
 
-func (m *Model) loadCurrentQuery(rowToSelect int) tea.Cmd {
+// searches the current query and shows the results from the top
+func (m *Model) loadCurrentQuery() tea.Cmd {
 	if query, ok := service.Queries().Current(); ok {
-		m.currentQueryString = query.Query
+		m.currentQuery = query
 		m.isLoading = true
 		m.list.SetItems([]list.Item{})
-		return tea.Batch(m.searchCurrentQuery(rowToSelect), m.spinner.Tick)
+		return tea.Batch(m.searchCurrentQuery(false, false), m.spinner.Tick)
 	}
 	return nil
 }
 
+// searches the current query again, keeping the list until the results arrive
+func (m *Model) reloadCurrentQuery() tea.Cmd {
+	if query, ok := service.Queries().Current(); ok {
+		m.currentQuery = query
+		m.isLoading = true
+		return tea.Batch(m.searchCurrentQuery(true, false), m.spinner.Tick)
+	}
+	return nil
+}
+
+func (m *Model) refreshMessages(ids []model.MessageID) tea.Cmd {
+	query, ok := service.Queries().Current()
+	if !ok {
+		return nil
+	}
+
+	return func() tea.Msg {
+		updated, removed, err := db.RefreshMessages(&query, ids)
+		return MessagesRefreshedMsg{Updated: updated, Removed: removed, Error: err, Query: query}
+	}
+}
+
+// updates the list in place, keeping the scroll position
+func (m *Model) patchList(updated []model.Message, removed []model.MessageID) {
+	for _, row := range service.Messages().UpdateMessages(updated) {
+		m.list.SetItem(row, MessageItem{
+			Message: service.Messages().Get(row),
+			Marked:  service.Messages().IsMarked(row),
+		})
+	}
+
+	// rows are in descending order, so removing one does not shift the others
+	for _, row := range service.Messages().RemoveMessages(removed) {
+		m.list.RemoveItem(row)
+	}
+
+	if count := len(m.list.Items()); count > 0 && m.list.Index() >= count {
+		m.list.Select(count - 1)
+	}
+	service.Messages().Select(m.list.Index())
+}
+
+func (m *Model) updateActiveList() {
+	if m.isThreadOpen() {
+		m.updateThreadList(m.threadList.Index())
+	} else {
+		m.updateList(m.list.Index())
+	}
+}
+
 func (m *Model) updateList(toSelect int) {
 	items := ListItemsFromMessages()
 
@@ -52,6 +52,22 @@ func formatTags(tags []string) string {
 	return strings.Join(tags, ",")
 }
 
+// Human readable size, e.g. 12.3 KiB
+func formatSize(bytes int) string {
+	if bytes < 1024 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	size := float64(bytes) / 1024
+	for _, unit := range []string{"KiB", "MiB", "GiB"} {
+		if size < 1024 {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
+	}
+	return fmt.Sprintf("%.1f TiB", size)
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
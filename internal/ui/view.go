@@ -21,6 +21,9 @@ func bgColor() lipgloss.Color {
 func (m Model) View() string {
 	tabs := m.renderTabs()
 	status := m.renderStatusLine()
+	if popup := m.renderCompletionPopup(); popup != "" {
+		status = popup + "\n" + status
+	}
 	mails := m.renderMails(m.height - (lipgloss.Height(tabs) + lipgloss.Height(status)))
 	return fmt.Sprintf("%s\n%s\n%s", tabs, mails, status)
 }
@@ -28,9 +31,10 @@ func (m Model) View() string {
 func (m *Model) setLayoutDimension(width, height int) {
 	m.width = width
 	m.height = height
-	m.list.SetHeight(1)
 	m.list.SetWidth(width - 2)
-	m.list.SetDelegate(MessageDelegate{width - 2})
+	m.updateListLayout()
+	m.threadList.SetWidth(width - 2)
+	m.threadList.SetDelegate(ThreadDelegate{width - 2})
 }
 
 // TABS
@@ -93,14 +97,16 @@ func (s BorderTabStyle) lipgloss() lipgloss.Style {
 func (m *Model) renderTabs() string {
 	var tabs []string
 	tabWidth := 0
+	format := m.runtime.TabFormat()
 	for i, query := range service.Queries().All() {
+		label := m.tabLabel(query, format)
 		queryTab := BorderTabStyle{
 			Active: i == service.Queries().SelectedIndex(),
 			First:  i == 0,
-		}.lipgloss().Render(query.Name)
+		}.lipgloss().Render(label)
 
 		tabs = append(tabs, queryTab)
-		tabWidth += utf8.RuneCountInString(query.Name) + 4
+		tabWidth += utf8.RuneCountInString(label) + 4
 	}
 	tabRow := lipgloss.JoinHorizontal(lipgloss.Bottom, tabs...)
 
@@ -123,9 +129,20 @@ func mailsStyle() lipgloss.Style {
 }
 
 func (m *Model) renderMails(listHeight int) string {
-	m.list.Styles.NoItems = lipgloss.NewStyle().Bold(true).Align(lipgloss.Center, lipgloss.Center).Width(m.width - 2).Height(listHeight - 1)
-	m.list.SetHeight(listHeight - 1)
-	return mailsStyle().Render(m.list.View())
+	listHeight = listHeight - 1
+	if m.showPreview {
+		listHeight -= m.preview.Height + 1
+	}
+
+	messageList := m.activeList()
+	messageList.Styles.NoItems = lipgloss.NewStyle().Bold(true).Align(lipgloss.Center, lipgloss.Center).Width(m.width - 2).Height(listHeight)
+	messageList.SetHeight(listHeight)
+
+	content := messageList.View()
+	if m.showPreview {
+		content = lipgloss.NewStyle().Height(listHeight).Render(content) + "\n" + m.renderPreview()
+	}
+	return mailsStyle().Render(content)
 }
 
 // STATUS LINE
@@ -137,6 +154,9 @@ func (m *Model) renderStatusLine() string {
 
 	// Get the status message to display (notification or original status)
 	leftStatus := service.Status().Get()
+	if pending := m.runtime.PendingKeys(); len(pending) > 0 {
+		leftStatus = strings.Join(pending, " ") + " …"
+	}
 	bgColor := lipgloss.Color(colorSecondaryBright)
 	if notification := m.GetCurrentNotification(); notification != nil {
 		leftStatus = notification.Message
@@ -146,6 +166,12 @@ func (m *Model) renderStatusLine() string {
 	var rightStatus string
 	if m.isLoading {
 		rightStatus = fmt.Sprintf("%s Searching...", m.spinner.View())
+	} else if thread, ok := service.ThreadMessages().Thread(); ok && m.isThreadOpen() {
+		markedCount := service.ThreadMessages().MarkedCount()
+		totalCount := service.ThreadMessages().Count()
+		currentPos := m.threadList.Index() + 1
+
+		rightStatus = fmt.Sprintf("%s｜%d/%d｜%d marked", truncate(cleanSubject(thread.Subject), 40), currentPos, totalCount, markedCount)
 	} else if query, ok := service.Queries().Current(); ok {
 		markedCount := service.Messages().MarkedCount()
 		totalCount := service.Messages().Count()
@@ -153,6 +179,9 @@ func (m *Model) renderStatusLine() string {
 
 		rightStatus = fmt.Sprintf("%s｜%d/%d｜%d marked", query.Query, currentPos, totalCount, markedCount)
 	}
+	if mode := m.runtime.Mode(); mode != "" {
+		rightStatus = fmt.Sprintf("[%s] %s", mode, rightStatus)
+	}
 	rightStatus = fmt.Sprintf("👀 %s ｢%s｣", rightStatus, time.Now().Format("15:04"))
 
 	spacing := max(m.width-2-lipgloss.Width(leftStatus)-lipgloss.Width(rightStatus), 1)
@@ -0,0 +1,88 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/service"
+)
+
+// sent periodically with the modification time of the database
+type DatabaseCheckMsg struct {
+	XapianDir string
+	Modified  time.Time
+	Error     error
+}
+
+// checks the database after ansicht.watch_interval seconds
+func (m *Model) watchDatabase() tea.Cmd {
+	interval := m.runtime.WatchInterval()
+	if interval <= 0 {
+		return nil
+	}
+
+	xapianDir := m.xapianDir
+	return tea.Tick(interval, func(time.Time) tea.Msg {
+		if xapianDir == "" {
+			dir, err := db.XapianDirectory()
+			if err != nil {
+				return DatabaseCheckMsg{Error: err}
+			}
+			xapianDir = dir
+		}
+
+		modified, err := db.DatabaseModified(xapianDir)
+		return DatabaseCheckMsg{XapianDir: xapianDir, Modified: modified, Error: err}
+	})
+}
+
+// reloads the current query in the background if the database changed
+func (m *Model) handleDatabaseCheck(msg DatabaseCheckMsg) tea.Cmd {
+	if msg.Error != nil && msg.XapianDir == "" {
+		// without the Xapian database, there is nothing to watch
+		service.Logger().Warning(fmt.Sprintf("not watching the database for changes: %v", msg.Error))
+		return nil
+	}
+	if msg.Error != nil {
+		// keep trying, maybe the database is being replaced
+		service.Logger().Warning(msg.Error.Error())
+		return m.watchDatabase()
+	}
+
+	m.xapianDir = msg.XapianDir
+	changed := !m.databaseModified.IsZero() && msg.Modified.After(m.databaseModified)
+	m.databaseModified = msg.Modified
+	if !changed {
+		return m.watchDatabase()
+	}
+
+	cmds := []tea.Cmd{m.watchDatabase(), m.countTabs()}
+	if _, ok := service.Queries().Current(); ok {
+		if m.loadingResults {
+			// the running search may have started before the change
+			m.pendingReload = true
+		} else {
+			cmds = append(cmds, m.searchCurrentQuery(true, true))
+		}
+	}
+	if m.isThreadOpen() {
+		cmds = append(cmds, m.loadThread(m.threadID))
+	}
+	return tea.Batch(cmds...)
+}
+
+// reloads the current query once the running search returned, if the database
+// changed while searching. Loading a thread does not delay the reload.
+func (m *Model) runPendingReload() tea.Cmd {
+	if !m.pendingReload || m.loadingResults {
+		return nil
+	}
+	m.pendingReload = false
+
+	if _, ok := service.Queries().Current(); !ok {
+		return nil
+	}
+	return m.searchCurrentQuery(true, true)
+}
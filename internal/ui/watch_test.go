@@ -0,0 +1,52 @@
+package ui
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDatabaseChangeWhileThreadLoads(t *testing.T) {
+	m := newTestModel(t, &fakeRuntime{})
+	m.databaseModified = time.Unix(1, 0)
+	xapianDir := t.TempDir()
+
+	// no search is running: the thread does not hold back the reload
+	m.loadThread("thread")
+	stream := m.stream
+	m.handleDatabaseCheck(DatabaseCheckMsg{XapianDir: xapianDir, Modified: time.Unix(2, 0)})
+	if m.pendingReload {
+		t.Fatalf("reload waits for the thread to load")
+	}
+	if m.stream == stream || !m.loadingResults {
+		t.Fatalf("the query was not searched again")
+	}
+
+	// the search is running: the reload waits for it, not for the thread
+	m.handleDatabaseCheck(DatabaseCheckMsg{XapianDir: xapianDir, Modified: time.Unix(3, 0)})
+	if !m.pendingReload {
+		t.Fatalf("reload does not wait for the running search")
+	}
+	m.isLoading = false // the thread was loaded
+	if cmd := m.runPendingReload(); cmd != nil || !m.pendingReload {
+		t.Fatalf("reload ran before the search returned")
+	}
+
+	m.loadingResults = false // the search returned
+	if cmd := m.runPendingReload(); cmd == nil || m.pendingReload {
+		t.Errorf("reload did not run after the search returned")
+	}
+}
+
+func TestDatabaseCheckStopsWithoutXapianDirectory(t *testing.T) {
+	m := newTestModel(t, &fakeRuntime{watchInterval: time.Hour})
+
+	if cmd := m.handleDatabaseCheck(DatabaseCheckMsg{Error: errors.New("cannot find Xapian database")}); cmd != nil {
+		t.Errorf("the database is still checked without a Xapian directory")
+	}
+
+	msg := DatabaseCheckMsg{XapianDir: t.TempDir(), Error: errors.New("cannot read database directory")}
+	if cmd := m.handleDatabaseCheck(msg); cmd == nil {
+		t.Errorf("the database is not checked again after a failed read")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -8,6 +9,9 @@ import (
 	"path/filepath"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/vrld/ansicht/internal/batch"
+	"github.com/vrld/ansicht/internal/db"
+	"github.com/vrld/ansicht/internal/remote"
 	"github.com/vrld/ansicht/internal/runtime"
 	"github.com/vrld/ansicht/internal/service"
 	"github.com/vrld/ansicht/internal/ui"
@@ -17,24 +21,70 @@ func main() {
 	handleCommandline()
 	defer service.Logger().Close()
 
+	if remoteCommand != "" {
+		os.Exit(sendRemoteCommand(remoteCommand))
+	}
+
+	// only the user interface reads input: batch runs leave the history file
+	// to the instances that do
+	isBatch := batchScript != "" || batchCode != ""
+	if !isBatch && !noHistory {
+		persistInputHistory()
+	}
+
 	runtime, err := runtime.LoadRuntime()
 	if err != nil {
 		log.Fatalf("Error loading configuration: %v", err)
 	}
+	defer db.CloseDatabase()
+
+	if isBatch {
+		luaCode, chunkName, err := batch.ReadScript(batchScript, batchCode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		exitCode := batch.Run(runtime, luaCode, chunkName, batchQuery)
+		db.CloseDatabase()
+		service.Logger().Close()
+		os.Exit(exitCode)
+	}
 
 	model := ui.NewModel(runtime)
 
 	p := tea.NewProgram(model, tea.WithAltScreen())
-	runtime.Controller = &ui.RuntimeAdapter{Program: p}
+	adapter := &ui.RuntimeAdapter{Program: p}
+	runtime.Controller = adapter
+
+	if listen {
+		server, err := remote.Listen(adapter, runtime)
+		if err != nil {
+			log.Fatalf("Error starting remote control: %v", err)
+		}
+		defer server.Close()
+		service.Logger().Info(fmt.Sprintf("Listening on %s", server.Path()))
+	}
+
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error running the program: %v", err)
 	}
 }
 
+var (
+	batchScript   string
+	batchCode     string
+	batchQuery    string
+	listen        bool
+	remoteCommand string
+	remoteSocket  string
+	noHistory     bool
+)
+
 func handleCommandline() {
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "ansicht - email at a glance\n\n")
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [options] -script file.lua | -e 'code'\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s -remote 'command [argument]' | -remote '{\"command\": ...}'\n\n", filepath.Base(os.Args[0]))
 
 		fmt.Fprintf(flag.CommandLine.Output(), "Options:\n")
 		flag.PrintDefaults()
@@ -43,9 +93,24 @@ func handleCommandline() {
 		fmt.Fprintf(flag.CommandLine.Output(), "  ansicht looks for configuration in:\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "    $XDG_CONFIG_HOME/ansicht/init.lua\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "    ~/.config/ansicht/init.lua\n")
+
+		fmt.Fprintf(flag.CommandLine.Output(), "\nInput history is saved in:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "    $XDG_STATE_HOME/ansicht/history\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "    ~/.local/state/ansicht/history\n")
+
+		fmt.Fprintf(flag.CommandLine.Output(), "\nRemote commands:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "    query <query>, next, prev, select <tab index or name>,\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "    refresh, notify <message>, selected, marked, eval <lua code>\n")
 	}
 
 	logFile := flag.String("log-file", "", "Write logs to this file if given")
+	flag.StringVar(&batchScript, "script", "", "Run this Lua script without the user interface and exit")
+	flag.StringVar(&batchCode, "e", "", "Run this Lua code without the user interface and exit")
+	flag.StringVar(&batchQuery, "query", "", "Search this query before running the script (default: first saved query)")
+	flag.BoolVar(&listen, "listen", false, "Accept remote commands on a socket in $XDG_RUNTIME_DIR/ansicht")
+	flag.StringVar(&remoteCommand, "remote", "", "Send a command to a running instance and print the response")
+	flag.StringVar(&remoteSocket, "socket", "", "Socket of the instance for -remote (default: most recently started)")
+	flag.BoolVar(&noHistory, "no-history", false, "Do not load or save the input history")
 	help := flag.Bool("h", false, "Show help message")
 	flag.Parse()
 
@@ -60,3 +125,34 @@ func handleCommandline() {
 		}
 	}
 }
+
+// returns the exit code
+func sendRemoteCommand(command string) int {
+	request, err := remote.ParseCommand(command)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	response, err := remote.Send(remoteSocket, request)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	json.NewEncoder(os.Stdout).Encode(response)
+	if !response.OK {
+		return 1
+	}
+	return 0
+}
+
+func persistInputHistory() {
+	path, err := service.DefaultInputHistoryPath()
+	if err == nil {
+		err = service.InputHistory().Persist(path)
+	}
+	if err != nil {
+		service.Logger().Error(fmt.Sprintf("Input history will not be saved: %v", err))
+	}
+}